@@ -0,0 +1,435 @@
+package exports
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/websockets"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Source interface {
+	repository.Repository
+	repository.ApiKeyRepository
+	repository.AuthEventRepository
+	repository.DataExportRepository
+	repository.IdentityRepository
+	repository.SessionRepository
+	repository.FollowRepository
+	repository.BlockRepository
+	repository.NotificationRepository
+	repository.MessageRepository
+	repository.CommentRepository
+	repository.ReactionRepository
+	repository.BookmarkRepository
+}
+
+type Profile struct {
+	models.Profile
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"emailVerified"`
+	TotpEnabled   bool     `json:"totpEnabled"`
+	Roles         []string `json:"roles"`
+}
+
+const (
+	// exportTimeout bounds a background export. Exports still pending after it
+	// lost their worker, e.g. to a restart, and are marked failed.
+	exportTimeout = time.Hour
+	sweepInterval = 10 * time.Minute
+	staleError    = "export did not finish, request a new one"
+	// followPageSize bounds the follows loaded by one query.
+	followPageSize = 500
+)
+
+// Exporter builds the personal data archive of a user. Accounts with more
+// posts than the synchronous limit are exported in the background and the
+// user is notified over the websocket when the archive can be downloaded.
+type Exporter struct {
+	source    Source
+	hub       *websockets.Hub
+	dir       string
+	syncLimit int
+	retention time.Duration
+}
+
+func NewExporter(source Source, hub *websockets.Hub, dir string, syncLimit int, retention time.Duration) (*Exporter, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{source: source, hub: hub, dir: dir, syncLimit: syncLimit, retention: retention}, nil
+}
+
+func (e *Exporter) IsLarge(ctx context.Context, userId string) (bool, error) {
+	count, err := e.source.CountPostsByUser(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	return count > e.syncLimit, nil
+}
+
+func (e *Exporter) WriteArchive(ctx context.Context, w io.Writer, userId string) error {
+	archive := zip.NewWriter(w)
+
+	user, err := e.source.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	roles, err := e.source.GetUserRoles(ctx, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "profile.json", Profile{
+		Profile:       user.Profile(),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		TotpEnabled:   user.TotpEnabled,
+		Roles:         roles,
+	})
+	if err != nil {
+		return err
+	}
+
+	apiKeys, err := e.source.GetApiKeysByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "api_keys.json", apiKeys)
+	if err != nil {
+		return err
+	}
+
+	identities, err := e.source.GetIdentitiesByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "identities.json", identities)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := e.source.GetSessionsByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "sessions.json", sessions)
+	if err != nil {
+		return err
+	}
+
+	following, err := collectFollows(ctx, e.source.GetFollowing, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "following.json", following)
+	if err != nil {
+		return err
+	}
+	followers, err := collectFollows(ctx, e.source.GetFollowers, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "followers.json", followers)
+	if err != nil {
+		return err
+	}
+
+	blocked, err := e.source.GetBlockedUsers(ctx, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "blocks.json", blocked)
+	if err != nil {
+		return err
+	}
+	muted, err := e.source.GetMutedUsers(ctx, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "mutes.json", muted)
+	if err != nil {
+		return err
+	}
+
+	collections, err := e.source.GetBookmarkCollections(ctx, userId)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "bookmark_collections.json", collections)
+	if err != nil {
+		return err
+	}
+
+	posts, err := archive.Create("posts.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(posts)
+	err = e.source.ForEachPostByUser(ctx, userId, func(post models.Post) error {
+		return encoder.Encode(post)
+	})
+	if err != nil {
+		return err
+	}
+
+	comments, err := archive.Create("comments.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder = json.NewEncoder(comments)
+	err = e.source.ForEachCommentByUser(ctx, userId, func(comment models.Comment) error {
+		return encoder.Encode(comment)
+	})
+	if err != nil {
+		return err
+	}
+
+	reactions, err := archive.Create("reactions.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder = json.NewEncoder(reactions)
+	err = e.source.ForEachReactionByUser(ctx, userId, func(reaction models.Reaction) error {
+		return encoder.Encode(reaction)
+	})
+	if err != nil {
+		return err
+	}
+
+	bookmarks, err := archive.Create("bookmarks.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder = json.NewEncoder(bookmarks)
+	err = e.source.ForEachBookmarkByUser(ctx, userId, func(bookmark models.Bookmark) error {
+		return encoder.Encode(bookmark)
+	})
+	if err != nil {
+		return err
+	}
+
+	events, err := archive.Create("auth_events.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder = json.NewEncoder(events)
+	err = e.source.ForEachAuthEventByUser(ctx, userId, func(event models.AuthEvent) error {
+		return encoder.Encode(event)
+	})
+	if err != nil {
+		return err
+	}
+
+	notifications, err := archive.Create("notifications.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder = json.NewEncoder(notifications)
+	err = e.source.ForEachNotificationByUser(ctx, userId, func(notification models.Notification) error {
+		return encoder.Encode(notification)
+	})
+	if err != nil {
+		return err
+	}
+
+	messages, err := archive.Create("messages.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder = json.NewEncoder(messages)
+	err = e.source.ForEachMessageByUser(ctx, userId, func(message models.Message) error {
+		return encoder.Encode(message)
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// collectFollows reads a whole follow list one page at a time. The list is
+// read without a viewer, so users the owner blocked or muted are kept.
+func collectFollows(ctx context.Context, list func(ctx context.Context, viewerId string, userId string, after *models.Cursor, limit int) ([]models.Follow, error), userId string) ([]models.Follow, error) {
+	follows := make([]models.Follow, 0)
+	var after *models.Cursor
+	for {
+		page, err := list(ctx, "", userId, after, followPageSize)
+		if err != nil {
+			return nil, err
+		}
+		follows = append(follows, page...)
+		if len(page) < followPageSize {
+			return follows, nil
+		}
+		last := page[len(page)-1]
+		after = &models.Cursor{CreatedAt: last.FollowedAt, Id: last.Id}
+	}
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// Start queues a background export, reusing the one already pending for the user.
+func (e *Exporter) Start(ctx context.Context, userId string) (*models.DataExport, error) {
+	pending, err := e.source.GetPendingDataExport(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if pending.Id != "" && time.Since(pending.CreatedAt) < exportTimeout {
+		return pending, nil
+	}
+	if pending.Id != "" {
+		err = e.source.FailStaleDataExports(ctx, time.Now().Add(-exportTimeout), staleError)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	export := &models.DataExport{
+		Id:     id.String(),
+		UserId: userId,
+		Status: models.DataExportPending,
+	}
+	err = e.source.InsertDataExport(ctx, export)
+	if err != nil {
+		return nil, err
+	}
+
+	go e.run(*export)
+	return export, nil
+}
+
+func (e *Exporter) run(export models.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	err := e.writeFile(ctx, export)
+	now := time.Now()
+	export.CompletedAt = &now
+	messageType := "Export_Ready"
+	if err != nil {
+		log.Printf("error exporting data of user %s %v", export.UserId, err)
+		export.Status = models.DataExportFailed
+		export.Error = "export could not be generated"
+		messageType = "Export_Failed"
+	} else {
+		expiresAt := now.Add(e.retention)
+		export.Status = models.DataExportCompleted
+		export.ExpiresAt = &expiresAt
+	}
+
+	// the export context may have run out, the outcome must still be stored
+	err = e.source.UpdateDataExport(context.Background(), &export)
+	if err != nil {
+		log.Printf("error updating data export %s %v", export.Id, err)
+		return
+	}
+	e.hub.SendToUser(export.UserId, models.WebsocketMessage{
+		Type:    messageType,
+		Payload: export,
+	})
+}
+
+func (e *Exporter) writeFile(ctx context.Context, export models.DataExport) error {
+	temporary := e.path(export.Id) + ".tmp"
+	file, err := os.OpenFile(temporary, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = e.WriteArchive(ctx, file, export.UserId)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(temporary)
+		return err
+	}
+	return os.Rename(temporary, e.path(export.Id))
+}
+
+func (e *Exporter) path(id string) string {
+	return filepath.Join(e.dir, id+".zip")
+}
+
+// Open returns the archive of a completed export that has not expired yet.
+func (e *Exporter) Open(ctx context.Context, id string, userId string) (*os.File, error) {
+	export, err := e.source.GetDataExport(ctx, id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if export.Id == "" || export.Status != models.DataExportCompleted {
+		return nil, os.ErrNotExist
+	}
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now()) {
+		_ = os.Remove(e.path(id))
+		return nil, fmt.Errorf("export has expired: %w", os.ErrNotExist)
+	}
+	return os.Open(e.path(id))
+}
+
+// Run sweeps the exports every sweepInterval until the context is done: stale
+// pending exports are marked failed and expired archives are deleted.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		e.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Exporter) sweep(ctx context.Context) {
+	now := time.Now()
+	err := e.source.FailStaleDataExports(ctx, now.Add(-exportTimeout), staleError)
+	if err != nil {
+		log.Printf("error failing stale data exports %v", err)
+	}
+
+	expired, err := e.source.ExpireDataExports(ctx, now)
+	if err != nil {
+		log.Printf("error expiring data exports %v", err)
+	}
+	for _, id := range expired {
+		err := os.Remove(e.path(id))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("error deleting data export %s %v", id, err)
+		}
+	}
+
+	// archives left half written by a crash
+	temporary, err := filepath.Glob(filepath.Join(e.dir, "*.tmp"))
+	if err != nil {
+		log.Printf("error listing data exports %v", err)
+		return
+	}
+	for _, file := range temporary {
+		info, err := os.Stat(file)
+		if err == nil && now.Sub(info.ModTime()) > exportTimeout {
+			_ = os.Remove(file)
+		}
+	}
+}
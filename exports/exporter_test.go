@@ -0,0 +1,162 @@
+package exports
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"go-rest-websockets/models"
+	"strconv"
+	"testing"
+)
+
+// source serves one user with an item of each kind of data the archive
+// holds. Calls it does not stub panic on the nil embedded Source.
+type source struct {
+	Source
+	failPosts bool
+}
+
+func (s *source) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	return &models.User{Id: id, Email: "john@doe.com", Handle: "john"}, nil
+}
+
+func (s *source) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (s *source) GetApiKeysByUser(ctx context.Context, userId string) ([]models.ApiKey, error) {
+	return []models.ApiKey{}, nil
+}
+
+func (s *source) GetIdentitiesByUser(ctx context.Context, userId string) ([]models.Identity, error) {
+	return []models.Identity{{Issuer: "https://accounts.example", Subject: "subject", UserId: userId}}, nil
+}
+
+func (s *source) GetSessionsByUser(ctx context.Context, userId string) ([]models.Session, error) {
+	return []models.Session{{Id: "session", UserId: userId}}, nil
+}
+
+func (s *source) GetFollowing(ctx context.Context, viewerId string, userId string, after *models.Cursor, limit int) ([]models.Follow, error) {
+	return s.follows(after, limit), nil
+}
+
+func (s *source) GetFollowers(ctx context.Context, viewerId string, userId string, after *models.Cursor, limit int) ([]models.Follow, error) {
+	return s.follows(after, limit), nil
+}
+
+// follows serves a full first page and a second one with a single follow.
+func (s *source) follows(after *models.Cursor, limit int) []models.Follow {
+	if after != nil {
+		return []models.Follow{{Profile: models.Profile{Id: "last"}}}
+	}
+	follows := make([]models.Follow, limit)
+	for index := range follows {
+		follows[index].Id = strconv.Itoa(index)
+	}
+	return follows
+}
+
+func (s *source) GetBlockedUsers(ctx context.Context, userId string) ([]models.Profile, error) {
+	return []models.Profile{{Id: "blocked"}}, nil
+}
+
+func (s *source) GetMutedUsers(ctx context.Context, userId string) ([]models.Profile, error) {
+	return []models.Profile{{Id: "muted"}}, nil
+}
+
+func (s *source) ForEachPostByUser(ctx context.Context, userId string, fn func(post models.Post) error) error {
+	if s.failPosts {
+		return errors.New("connection lost")
+	}
+	return fn(models.Post{Id: "post", UserId: userId, PostType: models.PostTypePost})
+}
+
+func (s *source) ForEachAuthEventByUser(ctx context.Context, userId string, fn func(event models.AuthEvent) error) error {
+	return fn(models.AuthEvent{Id: 1, UserId: userId})
+}
+
+func (s *source) ForEachNotificationByUser(ctx context.Context, userId string, fn func(notification models.Notification) error) error {
+	return fn(models.Notification{Id: "notification", UserId: userId, Type: models.NotificationFollow})
+}
+
+func (s *source) ForEachMessageByUser(ctx context.Context, userId string, fn func(message models.Message) error) error {
+	return fn(models.Message{Id: "message", ConversationId: "conversation", SenderId: userId})
+}
+
+func (s *source) ForEachCommentByUser(ctx context.Context, userId string, fn func(comment models.Comment) error) error {
+	return fn(models.Comment{Id: "comment", PostId: "post", UserId: userId})
+}
+
+func (s *source) ForEachReactionByUser(ctx context.Context, userId string, fn func(reaction models.Reaction) error) error {
+	return fn(models.Reaction{PostId: "post", Reaction: models.ReactionLike})
+}
+
+func (s *source) GetBookmarkCollections(ctx context.Context, userId string) ([]models.BookmarkCollection, error) {
+	return []models.BookmarkCollection{{Id: "collection", UserId: userId, Name: "Later"}}, nil
+}
+
+func (s *source) ForEachBookmarkByUser(ctx context.Context, userId string, fn func(bookmark models.Bookmark) error) error {
+	return fn(models.Bookmark{PostId: "post", CollectionId: "collection"})
+}
+
+func TestWriteArchive(t *testing.T) {
+	exporter := &Exporter{source: &source{}}
+	archive := &bytes.Buffer{}
+	err := exporter.WriteArchive(context.Background(), archive, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	files := map[string]bool{}
+	for _, file := range reader.File {
+		files[file.Name] = true
+	}
+	for _, name := range archiveFiles {
+		if !files[name] {
+			t.Errorf("archive is missing %s", name)
+		}
+	}
+}
+
+func TestCollectFollows(t *testing.T) {
+	follows, err := collectFollows(context.Background(), (&source{}).GetFollowers, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(follows) != followPageSize+1 || follows[followPageSize].Id != "last" {
+		t.Fatalf("collected %d follows, want every page", len(follows))
+	}
+}
+
+func TestWriteArchiveFails(t *testing.T) {
+	exporter := &Exporter{source: &source{failPosts: true}}
+	err := exporter.WriteArchive(context.Background(), &bytes.Buffer{}, "user")
+	if err == nil {
+		t.Fatal("archive written without the posts")
+	}
+}
+
+// archiveFiles lists the files every archive holds, each kind of personal
+// data the service keeps has to be in one of them.
+var archiveFiles = []string{
+	"profile.json",
+	"api_keys.json",
+	"identities.json",
+	"sessions.json",
+	"following.json",
+	"followers.json",
+	"blocks.json",
+	"mutes.json",
+	"bookmark_collections.json",
+	"posts.ndjson",
+	"comments.ndjson",
+	"reactions.ndjson",
+	"bookmarks.ndjson",
+	"auth_events.ndjson",
+	"notifications.ndjson",
+	"messages.ndjson",
+}
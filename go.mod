@@ -3,12 +3,13 @@ module go-rest-websockets
 go 1.18
 
 require (
-	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
-	github.com/golang-jwt/jwt/v4 v4.4.1 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/joho/godotenv v1.4.0 // indirect
-	github.com/lib/pq v1.10.5 // indirect
-	github.com/segmentio/ksuid v1.0.4 // indirect
-	golang.org/x/crypto v0.0.0-20220507011949-2cf3adece122 // indirect
+	github.com/golang-jwt/jwt v3.2.2+incompatible
+	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.5.0
+	github.com/joho/godotenv v1.4.0
+	github.com/lib/pq v1.10.5
+	github.com/segmentio/ksuid v1.0.4
+	golang.org/x/crypto v0.0.0-20220507011949-2cf3adece122
 )
+
+require github.com/golang-jwt/jwt/v4 v4.4.1 // indirect
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-rest-websockets/mailer"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func currentUser(w http.ResponseWriter, r *http.Request, repo repository.Repository) (*models.User, bool) {
+	principal, ok := server.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	user, err := repo.GetUserById(r.Context(), principal.UserId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if user.Id == "" {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+func checkPassword(w http.ResponseWriter, user *models.User, password string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func ChangePasswordHandler(s server.Server, repo repository.Repository, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		changeRequest := ChangePasswordRequest{}
+		err := json.NewDecoder(r.Body).Decode(&changeRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = validatePassword(changeRequest.NewPassword)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, ok := currentUser(w, r, repo)
+		if !ok || !checkPassword(w, user, changeRequest.CurrentPassword) {
+			return
+		}
+
+		hashed, err := bcrypt.GenerateFromPassword([]byte(changeRequest.NewPassword), HashCost)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = repo.UpdateUserPassword(r.Context(), user.Id, string(hashed))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = auth.RevokeUserCredentials(r.Context(), user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ChangeEmailHandler(s server.Server, repo repository.Repository, tokens repository.UserTokenRepository, mail mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		changeRequest := ChangeEmailRequest{}
+		err := json.NewDecoder(r.Body).Decode(&changeRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		changeRequest.Email = strings.TrimSpace(changeRequest.Email)
+		err = validateEmail(changeRequest.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, ok := currentUser(w, r, repo)
+		if !ok || !checkPassword(w, user, changeRequest.Password) {
+			return
+		}
+		existing, err := repo.GetUserByEmail(r.Context(), changeRequest.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing.Id != "" {
+			http.Error(w, "email address is already in use", http.StatusConflict)
+			return
+		}
+
+		secret, err := issueUserToken(r.Context(), tokens, user.Id, models.UserTokenEmailChange, changeRequest.Email, EmailVerificationExpires)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendMailInBackground(mail, mailer.Message{
+			To:      changeRequest.Email,
+			Subject: "Confirm your new email address",
+			Body:    fmt.Sprintf("Open the following link to use this address for your account. It expires in %v.\n\n%s", EmailVerificationExpires, userTokenLink(s, "/verify/email-change", secret)),
+		})
+		sendMailInBackground(mail, mailer.Message{
+			To:      user.Email,
+			Subject: "Your email address is being changed",
+			Body:    "A change of the email address of your account was requested. If this was not you, reset your password.",
+		})
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func ConfirmEmailChangeHandler(s server.Server, repo repository.Repository, tokens repository.UserTokenRepository, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := tokens.ConsumeUserToken(r.Context(), models.UserTokenEmailChange, server.HashSecret(r.URL.Query().Get("token")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if token.Id == "" {
+			http.Error(w, "verification token is invalid or has expired", http.StatusBadRequest)
+			return
+		}
+		existing, err := repo.GetUserByEmail(r.Context(), token.Data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing.Id != "" {
+			http.Error(w, "email address is already in use", http.StatusConflict)
+			return
+		}
+		err = repo.UpdateUserEmail(r.Context(), token.UserId, token.Data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = auth.RevokeUserCredentials(r.Context(), token.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		user, err := repo.GetUserById(r.Context(), token.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(MeResponse{Profile: user.Profile(), Email: user.Email, EmailVerified: user.EmailVerified})
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func DeleteAccountHandler(s server.Server, repo repository.Repository, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deleteRequest := DeleteAccountRequest{}
+		err := json.NewDecoder(r.Body).Decode(&deleteRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, ok := currentUser(w, r, repo)
+		if !ok || !checkPassword(w, user, deleteRequest.Password) {
+			return
+		}
+
+		switch s.Config().AccountDeletion {
+		case server.AccountDeletionDelete:
+			err = repo.DeleteUser(r.Context(), user.Id)
+		default:
+			err = repo.AnonymizeUser(r.Context(), user.Id, fmt.Sprintf("deleted+%s@users.invalid", user.Id))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = auth.RevokeUserCredentials(r.Context(), user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
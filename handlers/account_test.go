@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"go-rest-websockets/mailer"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "password123"
+
+// userAccountRepository holds the account of john@doe.com next to the one of
+// jane@doe.com, and records what happens to the account of john.
+type userAccountRepository struct {
+	repository.Repository
+	repository.ApiKeyRepository
+	repository.SessionRepository
+	repository.RevocationRepository
+	user      models.User
+	deletedAs string
+	revoked   bool
+}
+
+func newUserAccountRepository(t *testing.T) *userAccountRepository {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &userAccountRepository{user: models.User{Id: "user", Email: "john@doe.com", Password: string(hashed)}}
+}
+
+func (r *userAccountRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	if id != r.user.Id || r.deletedAs != "" {
+		return &models.User{}, nil
+	}
+	user := r.user
+	return &user, nil
+}
+
+func (r *userAccountRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	switch email {
+	case r.user.Email:
+		user := r.user
+		return &user, nil
+	case "jane@doe.com":
+		return &models.User{Id: "jane", Email: email}, nil
+	}
+	return &models.User{}, nil
+}
+
+func (r *userAccountRepository) UpdateUserPassword(ctx context.Context, userId string, password string) error {
+	r.user.Password = password
+	return nil
+}
+
+func (r *userAccountRepository) UpdateUserEmail(ctx context.Context, userId string, email string) error {
+	r.user.Email = email
+	return nil
+}
+
+func (r *userAccountRepository) DeleteUser(ctx context.Context, userId string) error {
+	r.deletedAs = "deleted"
+	return nil
+}
+
+func (r *userAccountRepository) AnonymizeUser(ctx context.Context, userId string, placeholderEmail string) error {
+	r.deletedAs = placeholderEmail
+	return nil
+}
+
+func (r *userAccountRepository) RevokeUserApiKeys(ctx context.Context, userId string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (r *userAccountRepository) RevokeUserSessions(ctx context.Context, userId string) error {
+	return nil
+}
+
+func (r *userAccountRepository) RevokeUserTokens(ctx context.Context, revocation *models.UserTokenRevocation) error {
+	r.revoked = true
+	return nil
+}
+
+func newAccountAuthorization(t *testing.T, repo *userAccountRepository) server.Authorization {
+	t.Helper()
+	keys, err := server.LoadKeySet(t.TempDir(), server.AlgorithmEdDSA, 3*time.Hour, 2*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.NewAuthorization(keys, server.NewRevocationStore(repo, websockets.NewHub()), repo, repo)
+}
+
+func accountRequest(method string, target string, body string) *http.Request {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	return request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	repo := newUserAccountRepository(t)
+	handler := ChangePasswordHandler(nil, repo, newAccountAuthorization(t, repo))
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"short password", `{"currentPassword":"` + testPassword + `","newPassword":"short"}`, http.StatusBadRequest},
+		{"wrong password", `{"currentPassword":"wrong","newPassword":"new-password"}`, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		handler(recorder, accountRequest(http.MethodPut, "/me/password", c.body))
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+	if repo.revoked {
+		t.Fatal("credentials revoked by a rejected change")
+	}
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, accountRequest(http.MethodPut, "/me/password", `{"currentPassword":"`+testPassword+`","newPassword":"new-password"}`))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("status is %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(repo.user.Password), []byte("new-password")) != nil {
+		t.Error("password was not changed")
+	}
+	if !repo.revoked {
+		t.Error("credentials survived the password change")
+	}
+}
+
+func TestChangeEmailHandler(t *testing.T) {
+	repo := newUserAccountRepository(t)
+	tokens := newTokenRepository()
+	s := testServer{config: &server.Config{PublicUrl: "http://localhost:5050"}}
+	handler := ChangeEmailHandler(s, repo, tokens, mailer.NewMemoryMailer())
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid address", `{"email":"john","password":"` + testPassword + `"}`, http.StatusBadRequest},
+		{"wrong password", `{"email":"john@new.com","password":"wrong"}`, http.StatusUnauthorized},
+		{"address in use", `{"email":"jane@doe.com","password":"` + testPassword + `"}`, http.StatusConflict},
+		{"new address", `{"email":"john@new.com","password":"` + testPassword + `"}`, http.StatusAccepted},
+	}
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		handler(recorder, accountRequest(http.MethodPut, "/me/email", c.body))
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+	// the address only changes once the link mailed to it is opened
+	if repo.user.Email != "john@doe.com" {
+		t.Errorf("email changed to %s before confirmation", repo.user.Email)
+	}
+	if len(tokens.tokens) != 1 || tokens.tokens[0].Data != "john@new.com" {
+		t.Fatalf("issued tokens are %+v, want one for the new address", tokens.tokens)
+	}
+}
+
+func TestConfirmEmailChangeHandler(t *testing.T) {
+	repo := newUserAccountRepository(t)
+	tokens := newTokenRepository()
+	handler := ConfirmEmailChangeHandler(nil, repo, tokens, newAccountAuthorization(t, repo))
+	for secret, email := range map[string]string{"secret": "john@new.com", "taken": "jane@doe.com"} {
+		_ = tokens.InsertUserToken(context.Background(), &models.UserToken{
+			Id:        secret,
+			UserId:    "user",
+			Purpose:   models.UserTokenEmailChange,
+			TokenHash: server.HashSecret(secret),
+			ExpiresAt: time.Now().Add(time.Hour),
+			Data:      email,
+		})
+	}
+	cases := []struct {
+		name   string
+		secret string
+		status int
+	}{
+		{"invalid token", "invalid", http.StatusBadRequest},
+		{"address taken meanwhile", "taken", http.StatusConflict},
+		{"token", "secret", http.StatusOK},
+		{"reused token", "secret", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodGet, "/verify/email-change?token="+url.QueryEscape(c.secret), nil)
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+	if repo.user.Email != "john@new.com" {
+		t.Errorf("email is %s, want john@new.com", repo.user.Email)
+	}
+	if !repo.revoked {
+		t.Error("credentials survived the email change")
+	}
+}
+
+func TestDeleteAccountHandler(t *testing.T) {
+	cases := []struct {
+		name      string
+		deletion  string
+		password  string
+		status    int
+		deletedAs string
+	}{
+		{"wrong password", server.AccountDeletionAnonymize, "wrong", http.StatusUnauthorized, ""},
+		{"anonymize", server.AccountDeletionAnonymize, testPassword, http.StatusNoContent, "deleted+user@users.invalid"},
+		{"delete", server.AccountDeletionDelete, testPassword, http.StatusNoContent, "deleted"},
+	}
+	for _, c := range cases {
+		repo := newUserAccountRepository(t)
+		s := testServer{config: &server.Config{AccountDeletion: c.deletion}}
+		recorder := httptest.NewRecorder()
+		DeleteAccountHandler(s, repo, newAccountAuthorization(t, repo))(recorder, accountRequest(http.MethodDelete, "/me", `{"password":"`+c.password+`"}`))
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+		if repo.deletedAs != c.deletedAs {
+			t.Errorf("%s: account deleted as %q, want %q", c.name, repo.deletedAs, c.deletedAs)
+		}
+		if repo.revoked != (c.status == http.StatusNoContent) {
+			t.Errorf("%s: credentials revoked is %v", c.name, repo.revoked)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+type RolesResponse struct {
+	UserId string   `json:"userId"`
+	Roles  []string `json:"roles"`
+}
+
+func authorizeRoleManagement(w http.ResponseWriter, r *http.Request) bool {
+	principal, ok := server.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !principal.Can(server.PermissionRolesManage) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func writeUserRoles(w http.ResponseWriter, r *http.Request, repo repository.Repository, userId string) {
+	roles, err := repo.GetUserRoles(r.Context(), userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(RolesResponse{UserId: userId, Roles: roles})
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+func GetUserRolesHandler(s server.Server, repo repository.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeRoleManagement(w, r) {
+			return
+		}
+		writeUserRoles(w, r, repo, mux.Vars(r)["id"])
+	}
+}
+
+func GrantRoleHandler(s server.Server, repo repository.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeRoleManagement(w, r) {
+			return
+		}
+		roleRequest := RoleRequest{}
+		err := json.NewDecoder(r.Body).Decode(&roleRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !server.IsKnownRole(roleRequest.Role) {
+			http.Error(w, fmt.Sprintf("unknown role %q", roleRequest.Role), http.StatusBadRequest)
+			return
+		}
+		userId := mux.Vars(r)["id"]
+		user, err := repo.GetUserById(r.Context(), userId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		err = repo.AddUserRole(r.Context(), userId, roleRequest.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeUserRoles(w, r, repo, userId)
+	}
+}
+
+func RevokeRoleHandler(s server.Server, repo repository.Repository, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeRoleManagement(w, r) {
+			return
+		}
+		params := mux.Vars(r)
+		userId := params["id"]
+		err := repo.RemoveUserRole(r.Context(), userId, params["role"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// roles travel inside the token, so existing tokens would keep the revoked role
+		err = auth.RevokeUserTokens(r.Context(), userId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeUserRoles(w, r, repo, userId)
+	}
+}
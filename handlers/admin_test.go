@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roleRepository holds the roles of "user" and takes the revocations of
+// their sessions and tokens.
+type roleRepository struct {
+	repository.Repository
+	repository.RevocationRepository
+	repository.SessionRepository
+	roles []string
+}
+
+func (r *roleRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	if id != "user" {
+		return &models.User{}, nil
+	}
+	return &models.User{Id: id}, nil
+}
+
+func (r *roleRepository) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	return r.roles, nil
+}
+
+func (r *roleRepository) AddUserRole(ctx context.Context, userId string, role string) error {
+	r.roles = append(r.roles, role)
+	return nil
+}
+
+func (r *roleRepository) RemoveUserRole(ctx context.Context, userId string, role string) error {
+	roles := make([]string, 0, len(r.roles))
+	for _, granted := range r.roles {
+		if granted != role {
+			roles = append(roles, granted)
+		}
+	}
+	r.roles = roles
+	return nil
+}
+
+func (r *roleRepository) RevokeUserTokens(ctx context.Context, revocation *models.UserTokenRevocation) error {
+	return nil
+}
+
+func (r *roleRepository) RevokeUserSessions(ctx context.Context, userId string) error {
+	return nil
+}
+
+func newRoleAuthorization(t *testing.T, repo *roleRepository) server.Authorization {
+	t.Helper()
+	keys, err := server.LoadKeySet(t.TempDir(), server.AlgorithmEdDSA, 3*time.Hour, 2*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.NewAuthorization(keys, server.NewRevocationStore(repo, websockets.NewHub()), nil, repo)
+}
+
+func roleRequest(method string, target string, vars map[string]string, body string, principal *server.Principal) *http.Request {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request = mux.SetURLVars(request, vars)
+	return request.WithContext(server.WithPrincipal(request.Context(), principal))
+}
+
+func TestRoleManagementIsForAdmins(t *testing.T) {
+	repo := &roleRepository{}
+	auth := newRoleAuthorization(t, repo)
+	moderator := &server.Principal{UserId: "moderator", Roles: []string{server.RoleModerator}, TokenId: "token"}
+	vars := map[string]string{"id": "user", "role": server.RoleModerator}
+	handlers := map[string]http.HandlerFunc{
+		"get":    GetUserRolesHandler(nil, repo),
+		"grant":  GrantRoleHandler(nil, repo),
+		"revoke": RevokeRoleHandler(nil, repo, auth),
+	}
+	for name, handler := range handlers {
+		recorder := httptest.NewRecorder()
+		handler(recorder, roleRequest(http.MethodPost, "/admin/users/user/roles", vars, `{"role":"moderator"}`, moderator))
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("%s by a moderator: status is %d, want %d", name, recorder.Code, http.StatusForbidden)
+		}
+	}
+	if len(repo.roles) != 0 {
+		t.Errorf("moderator changed roles to %v", repo.roles)
+	}
+}
+
+func TestGrantRoleHandler(t *testing.T) {
+	repo := &roleRepository{}
+	admin := &server.Principal{UserId: "admin", Roles: []string{server.RoleAdmin}, TokenId: "token"}
+	cases := []struct {
+		name   string
+		userId string
+		body   string
+		status int
+	}{
+		{"unknown role", "user", `{"role":"owner"}`, http.StatusBadRequest},
+		{"missing user", "missing", `{"role":"moderator"}`, http.StatusNotFound},
+		{"moderator", "user", `{"role":"moderator"}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		request := roleRequest(http.MethodPost, "/admin/users/"+c.userId+"/roles", map[string]string{"id": c.userId}, c.body, admin)
+		GrantRoleHandler(nil, repo)(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+	if len(repo.roles) != 1 || repo.roles[0] != server.RoleModerator {
+		t.Errorf("roles are %v, want the moderator role", repo.roles)
+	}
+}
+
+func TestRevokeRoleHandlerRevokesTokens(t *testing.T) {
+	repo := &roleRepository{roles: []string{server.RoleModerator}}
+	auth := newRoleAuthorization(t, repo)
+	admin := &server.Principal{UserId: "admin", Roles: []string{server.RoleAdmin}, TokenId: "token"}
+	// a token still carrying the moderator role
+	token, _, err := auth.SignImpersonationToken(admin, &models.User{Id: "user", Roles: repo.roles}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	vars := map[string]string{"id": "user", "role": server.RoleModerator}
+	RevokeRoleHandler(nil, repo, auth)(recorder, roleRequest(http.MethodDelete, "/admin/users/user/roles/moderator", vars, "", admin))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status is %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if len(repo.roles) != 0 {
+		t.Errorf("roles are %v, want none", repo.roles)
+	}
+	if _, err := auth.ParseAndVerifyToken(token); err == nil {
+		t.Error("token issued with the revoked role still accepted")
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type CreateApiKeyResponse struct {
+	models.ApiKey
+	Key string `json:"key"`
+}
+
+func CreateApiKeyHandler(s server.Server, repo repository.ApiKeyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		createRequest := CreateApiKeyRequest{}
+		err := json.NewDecoder(r.Body).Decode(&createRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		createRequest.Name = strings.TrimSpace(createRequest.Name)
+		if createRequest.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if len(createRequest.Scopes) == 0 {
+			http.Error(w, "at least one scope is required", http.StatusBadRequest)
+			return
+		}
+		for _, scope := range createRequest.Scopes {
+			if !server.IsKnownScope(scope) {
+				http.Error(w, fmt.Sprintf("unknown scope %q", scope), http.StatusBadRequest)
+				return
+			}
+		}
+		if createRequest.ExpiresAt != nil && createRequest.ExpiresAt.Before(time.Now()) {
+			http.Error(w, "expiresAt must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		key, keyHash, err := server.GenerateApiKey()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		apiKey := models.ApiKey{
+			Id:        id.String(),
+			UserId:    principal.UserId,
+			Name:      createRequest.Name,
+			KeyHash:   keyHash,
+			Scopes:    createRequest.Scopes,
+			ExpiresAt: createRequest.ExpiresAt,
+		}
+		err = repo.InsertApiKey(r.Context(), &apiKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(CreateApiKeyResponse{ApiKey: apiKey, Key: key})
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func ListApiKeysHandler(s server.Server, repo repository.ApiKeyRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		keys, err := repo.GetApiKeysByUser(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(keys)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func RevokeApiKeyHandler(s server.Server, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		revoked, err := auth.RevokeApiKey(r.Context(), mux.Vars(r)["id"], principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !revoked {
+			http.Error(w, "api key not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiKeyRepository keeps keys in memory, a revoked key is dropped.
+type apiKeyRepository struct {
+	repository.ApiKeyRepository
+	keys map[string]models.ApiKey
+}
+
+func (r *apiKeyRepository) InsertApiKey(ctx context.Context, key *models.ApiKey) error {
+	r.keys[key.Id] = *key
+	return nil
+}
+
+func (r *apiKeyRepository) GetApiKeyByHash(ctx context.Context, keyHash string) (*models.ApiKey, error) {
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			return &key, nil
+		}
+	}
+	return &models.ApiKey{}, nil
+}
+
+func (r *apiKeyRepository) RevokeApiKey(ctx context.Context, id string, userId string) (bool, error) {
+	key, ok := r.keys[id]
+	if !ok || key.UserId != userId {
+		return false, nil
+	}
+	delete(r.keys, id)
+	return true, nil
+}
+
+func (r *apiKeyRepository) TouchApiKey(ctx context.Context, id string, usedAt time.Time) error {
+	return nil
+}
+
+func newApiKeyAuthorization(t *testing.T, repo *apiKeyRepository) server.Authorization {
+	t.Helper()
+	keys, err := server.LoadKeySet(t.TempDir(), server.AlgorithmEdDSA, 3*time.Hour, 2*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.NewAuthorization(keys, server.NewRevocationStore(nil, websockets.NewHub()), repo, nil)
+}
+
+func createApiKey(repo *apiKeyRepository, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/me/api-keys", strings.NewReader(body))
+	request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+	recorder := httptest.NewRecorder()
+	CreateApiKeyHandler(nil, repo)(recorder, request)
+	return recorder
+}
+
+func TestCreateApiKeyHandlerValidates(t *testing.T) {
+	repo := &apiKeyRepository{keys: map[string]models.ApiKey{}}
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"without name", `{"name":" ","scopes":["posts:read"]}`},
+		{"without scopes", `{"name":"ci","scopes":[]}`},
+		{"unknown scope", `{"name":"ci","scopes":["users:delete"]}`},
+		{"expired", `{"name":"ci","scopes":["posts:read"],"expiresAt":"` + past + `"}`},
+	}
+	for _, c := range cases {
+		recorder := createApiKey(repo, c.body)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, http.StatusBadRequest)
+		}
+	}
+	if len(repo.keys) != 0 {
+		t.Errorf("%d invalid keys stored", len(repo.keys))
+	}
+}
+
+func TestApiKeyLifecycle(t *testing.T) {
+	repo := &apiKeyRepository{keys: map[string]models.ApiKey{}}
+	auth := newApiKeyAuthorization(t, repo)
+	recorder := createApiKey(repo, `{"name":"ci","scopes":["posts:read"]}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("status is %d, want %d", recorder.Code, http.StatusCreated)
+	}
+	created := CreateApiKeyResponse{}
+	err := json.NewDecoder(recorder.Body).Decode(&created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Key, server.ApiKeyPrefix) || repo.keys[created.Id].KeyHash == created.Key {
+		t.Fatal("key is not returned once and stored hashed")
+	}
+
+	principal, err := auth.Authenticate(context.Background(), created.Key)
+	if err != nil {
+		t.Fatalf("authenticating with the key: %v", err)
+	}
+	if principal.UserId != "user" || !principal.HasScope(server.ScopePostsRead) || principal.HasScope(server.ScopePostsWrite) {
+		t.Errorf("key principal is %+v", principal)
+	}
+
+	for _, c := range []struct {
+		userId string
+		status int
+	}{{"other", http.StatusNotFound}, {"user", http.StatusNoContent}} {
+		request := httptest.NewRequest(http.MethodDelete, "/me/api-keys/"+created.Id, nil)
+		request = mux.SetURLVars(request, map[string]string{"id": created.Id})
+		request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: c.userId, TokenId: "token"}))
+		recorder := httptest.NewRecorder()
+		RevokeApiKeyHandler(nil, auth)(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("revoking by %s: status is %d, want %d", c.userId, recorder.Code, c.status)
+		}
+	}
+	if _, err := auth.Authenticate(context.Background(), created.Key); err == nil {
+		t.Error("revoked key accepted")
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func recordAuthEvent(ctx context.Context, events repository.AuthEventRepository, r *http.Request, event string, userId string, email string) {
+	err := events.InsertAuthEvent(ctx, &models.AuthEvent{
+		UserId: userId,
+		Email:  email,
+		Ip:     clientIP(r),
+		Event:  event,
+	})
+	if err != nil {
+		log.Printf("error recording auth event %v", err)
+	}
+}
+
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "too many failed attempts, try again later", http.StatusTooManyRequests)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+// relationshipHandler applies change between the caller and the user named by
+// the handle in the route.
+func relationshipHandler(repo repository.Repository, change func(ctx context.Context, userId string, otherUserId string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, ok := userByHandle(w, r, repo)
+		if !ok {
+			return
+		}
+		if user.Id == principal.UserId {
+			http.Error(w, "cannot apply this to yourself", http.StatusBadRequest)
+			return
+		}
+		err := change(r.Context(), principal.UserId, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func BlockHandler(s server.Server, repo repository.Repository, blocks repository.BlockRepository) http.HandlerFunc {
+	return relationshipHandler(repo, blocks.Block)
+}
+
+func UnblockHandler(s server.Server, repo repository.Repository, blocks repository.BlockRepository) http.HandlerFunc {
+	return relationshipHandler(repo, blocks.Unblock)
+}
+
+func MuteHandler(s server.Server, repo repository.Repository, blocks repository.BlockRepository) http.HandlerFunc {
+	return relationshipHandler(repo, blocks.Mute)
+}
+
+func UnmuteHandler(s server.Server, repo repository.Repository, blocks repository.BlockRepository) http.HandlerFunc {
+	return relationshipHandler(repo, blocks.Unmute)
+}
+
+func listRelationshipsHandler(list func(ctx context.Context, userId string) ([]models.Profile, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		profiles, err := list(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(profiles)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func GetBlockedUsersHandler(s server.Server, blocks repository.BlockRepository) http.HandlerFunc {
+	return listRelationshipsHandler(blocks.GetBlockedUsers)
+}
+
+func GetMutedUsersHandler(s server.Server, blocks repository.BlockRepository) http.HandlerFunc {
+	return listRelationshipsHandler(blocks.GetMutedUsers)
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const MaxCollectionNameLength = 100
+
+type BookmarkCollectionRequest struct {
+	Name string `json:"name"`
+}
+
+type SaveBookmarkRequest struct {
+	CollectionId string `json:"collectionId"`
+}
+
+func collectionName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	collectionRequest := BookmarkCollectionRequest{}
+	err := json.NewDecoder(r.Body).Decode(&collectionRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	name := strings.TrimSpace(collectionRequest.Name)
+	if name == "" || utf8.RuneCountInString(name) > MaxCollectionNameLength {
+		http.Error(w, "name must be between 1 and 100 characters", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+func writeBookmarkCollection(w http.ResponseWriter, status int, collection *models.BookmarkCollection) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(collection)
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+// ownCollection reports whether the collection exists and belongs to userId,
+// answering 404 when it does not.
+func ownCollection(w http.ResponseWriter, r *http.Request, bookmarks repository.BookmarkRepository, userId string, id string) bool {
+	collection, err := bookmarks.GetBookmarkCollection(r.Context(), userId, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if collection.Id == "" {
+		http.Error(w, "collection not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func CreateBookmarkCollectionHandler(s server.Server, bookmarks repository.BookmarkRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		name, ok := collectionName(w, r)
+		if !ok {
+			return
+		}
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		collection := models.BookmarkCollection{Id: id.String(), UserId: principal.UserId, Name: name}
+		err = bookmarks.CreateBookmarkCollection(r.Context(), &collection)
+		if errors.Is(err, repository.ErrCollectionNameTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeBookmarkCollection(w, http.StatusCreated, &collection)
+	}
+}
+
+func GetBookmarkCollectionsHandler(s server.Server, bookmarks repository.BookmarkRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		collections, err := bookmarks.GetBookmarkCollections(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(collections)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func RenameBookmarkCollectionHandler(s server.Server, bookmarks repository.BookmarkRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		name, ok := collectionName(w, r)
+		if !ok {
+			return
+		}
+		id := mux.Vars(r)["id"]
+		renamed, err := bookmarks.RenameBookmarkCollection(r.Context(), principal.UserId, id, name)
+		if errors.Is(err, repository.ErrCollectionNameTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !renamed {
+			http.Error(w, "collection not found", http.StatusNotFound)
+			return
+		}
+		collection, err := bookmarks.GetBookmarkCollection(r.Context(), principal.UserId, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeBookmarkCollection(w, http.StatusOK, collection)
+	}
+}
+
+// DeleteBookmarkCollectionHandler deletes a collection, its bookmarks are kept
+// unfiled.
+func DeleteBookmarkCollectionHandler(s server.Server, bookmarks repository.BookmarkRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		deleted, err := bookmarks.DeleteBookmarkCollection(r.Context(), principal.UserId, mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "collection not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SaveBookmarkHandler bookmarks a post, filing it in the collection given in
+// the body if any. Saving an already bookmarked post moves it.
+func SaveBookmarkHandler(s server.Server, repo repository.Repository, bookmarks repository.BookmarkRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		saveRequest := SaveBookmarkRequest{}
+		err := json.NewDecoder(r.Body).Decode(&saveRequest)
+		if err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		post, ok := postFromPath(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		if saveRequest.CollectionId != "" && !ownCollection(w, r, bookmarks, principal.UserId, saveRequest.CollectionId) {
+			return
+		}
+		err = bookmarks.SaveBookmark(r.Context(), principal.UserId, post.Id, saveRequest.CollectionId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RemoveBookmarkHandler also works for bookmarks of posts that have since
+// been deleted, so unavailable entries can be cleaned up.
+func RemoveBookmarkHandler(s server.Server, bookmarks repository.BookmarkRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := bookmarks.RemoveBookmark(r.Context(), principal.UserId, mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetBookmarksHandler lists the caller's bookmarks, only those of one
+// collection when the collectionId query parameter is set.
+func GetBookmarksHandler(s server.Server, bookmarks repository.BookmarkRepository, reactions repository.ReactionRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		collectionId := r.URL.Query().Get("collectionId")
+		if collectionId != "" && !ownCollection(w, r, bookmarks, principal.UserId, collectionId) {
+			return
+		}
+		items, err := bookmarks.GetBookmarks(r.Context(), principal.UserId, collectionId, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		posts := make([]*models.Post, 0, len(items))
+		for _, bookmark := range items {
+			if bookmark.Post != nil {
+				posts = append(posts, bookmark.Post)
+			}
+		}
+		err = presentPosts(r, reactions, blocks, posts...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		page := Page{Items: items}
+		if len(items) == limit {
+			last := items[len(items)-1]
+			page.NextCursor = encodeCursor(last.CreatedAt, last.PostId)
+		}
+		writePage(w, page)
+	}
+}
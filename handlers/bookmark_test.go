@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCollectionName(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"blank", "  ", false},
+		{"short", "Recipes", true},
+		{"too long", strings.Repeat("a", MaxCollectionNameLength+1), false},
+		// the limit counts characters, not the bytes they take
+		{"longest multibyte", strings.Repeat("é", MaxCollectionNameLength), true},
+		{"too long multibyte", strings.Repeat("é", MaxCollectionNameLength+1), false},
+	}
+	for _, c := range cases {
+		body, err := json.Marshal(BookmarkCollectionRequest{Name: c.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := httptest.NewRequest(http.MethodPost, "/bookmarks/collections", strings.NewReader(string(body)))
+		_, valid := collectionName(httptest.NewRecorder(), request)
+		if valid != c.valid {
+			t.Errorf("%s: valid is %v, want %v", c.name, valid, c.valid)
+		}
+	}
+}
+
+// bookmarkRepository holds the collections of their owners and, like the
+// database, only finds a collection for the user owning it.
+type bookmarkRepository struct {
+	repository.Repository
+	repository.BookmarkRepository
+	repository.BlockRepository
+	repository.ReactionRepository
+	collections map[string]*models.BookmarkCollection
+	saved       map[string]string
+}
+
+func (r *bookmarkRepository) collection(userId string, id string) (*models.BookmarkCollection, bool) {
+	collection, ok := r.collections[id]
+	if !ok || collection.UserId != userId {
+		return nil, false
+	}
+	return collection, true
+}
+
+func (r *bookmarkRepository) GetBookmarkCollection(ctx context.Context, userId string, id string) (*models.BookmarkCollection, error) {
+	collection, ok := r.collection(userId, id)
+	if !ok {
+		return &models.BookmarkCollection{}, nil
+	}
+	return collection, nil
+}
+
+func (r *bookmarkRepository) RenameBookmarkCollection(ctx context.Context, userId string, id string, name string) (bool, error) {
+	collection, ok := r.collection(userId, id)
+	if ok {
+		collection.Name = name
+	}
+	return ok, nil
+}
+
+func (r *bookmarkRepository) DeleteBookmarkCollection(ctx context.Context, userId string, id string) (bool, error) {
+	_, ok := r.collection(userId, id)
+	if ok {
+		delete(r.collections, id)
+	}
+	return ok, nil
+}
+
+func (r *bookmarkRepository) SaveBookmark(ctx context.Context, userId string, postId string, collectionId string) error {
+	r.saved[userId] = collectionId
+	return nil
+}
+
+func (r *bookmarkRepository) GetBookmarks(ctx context.Context, userId string, collectionId string, after *models.Cursor, limit int) ([]models.Bookmark, error) {
+	return []models.Bookmark{}, nil
+}
+
+func (r *bookmarkRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
+	return &models.Post{Id: id, UserId: "author"}, nil
+}
+
+func (r *bookmarkRepository) IsBlocked(ctx context.Context, userId string, otherUserId string) (bool, error) {
+	return false, nil
+}
+
+func (r *bookmarkRepository) GetReactionSummaries(ctx context.Context, viewerId string, postIds []string) (map[string]*models.ReactionSummary, error) {
+	return map[string]*models.ReactionSummary{}, nil
+}
+
+func TestBookmarkCollectionsAreForTheirOwnerOnly(t *testing.T) {
+	repo := &bookmarkRepository{
+		collections: map[string]*models.BookmarkCollection{"recipes": {Id: "recipes", UserId: "alice", Name: "Recipes"}},
+		saved:       map[string]string{},
+	}
+	cases := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		vars    map[string]string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{"list", http.MethodGet, "/bookmarks?collectionId=recipes", "", nil, GetBookmarksHandler(nil, repo, repo, repo), http.StatusOK},
+		{"save", http.MethodPut, "/posts/post/bookmark", `{"collectionId":"recipes"}`, map[string]string{"id": "post"}, SaveBookmarkHandler(nil, repo, repo, repo), http.StatusNoContent},
+		{"rename", http.MethodPut, "/bookmarks/collections/recipes", `{"name":"Dinner"}`, map[string]string{"id": "recipes"}, RenameBookmarkCollectionHandler(nil, repo), http.StatusOK},
+		{"delete", http.MethodDelete, "/bookmarks/collections/recipes", "", map[string]string{"id": "recipes"}, DeleteBookmarkCollectionHandler(nil, repo), http.StatusNoContent},
+	}
+	for _, c := range cases {
+		// the collection of someone else is answered as missing, then the
+		// owner goes through, the delete last as it drops the collection
+		for _, userId := range []string{"mallory", "alice"} {
+			request := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+			if c.vars != nil {
+				request = mux.SetURLVars(request, c.vars)
+			}
+			request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: userId, TokenId: "token"}))
+			recorder := httptest.NewRecorder()
+			c.handler(recorder, request)
+			want := c.status
+			if userId != "alice" {
+				want = http.StatusNotFound
+			}
+			if recorder.Code != want {
+				t.Errorf("%s by %s: status is %d, want %d", c.name, userId, recorder.Code, want)
+			}
+		}
+	}
+	if _, ok := repo.saved["mallory"]; ok {
+		t.Error("bookmark filed in the collection of someone else")
+	}
+	if repo.saved["alice"] != "recipes" {
+		t.Errorf("bookmark of the owner filed in %q, want recipes", repo.saved["alice"])
+	}
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/notifications"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const MaxCommentLength = 2000
+
+type InsertCommentRequest struct {
+	Content  string `json:"content"`
+	ParentId string `json:"parentId"`
+}
+
+type UpdateCommentRequest struct {
+	Content string `json:"content"`
+}
+
+type CommentDeletedEvent struct {
+	Id     string `json:"id"`
+	PostId string `json:"postId"`
+}
+
+// publishToPost sends an event to the subscribers of a post, skipping users
+// hidden from the actor by blocks and mutes.
+func publishToPost(ctx context.Context, s server.Server, blocks repository.BlockRepository, postId string, actorId string, message models.WebsocketMessage) {
+	hidden, err := blocks.GetUsersHiding(ctx, actorId)
+	if err != nil {
+		log.Printf("error loading users hiding %s %v", actorId, err)
+		return
+	}
+	s.Hub().Publish(websockets.PostTopic(postId), message, hidden)
+}
+
+// postFromPath loads the post named in the path, answering 404 when it does
+// not exist or a block hides it from the caller.
+func postFromPath(w http.ResponseWriter, r *http.Request, repo repository.Repository, blocks repository.BlockRepository) (*models.Post, bool) {
+	post, err := repo.GetPostById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if post.Id == "" {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return nil, false
+	}
+	hidden, err := hiddenByBlock(r, blocks, post.UserId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if hidden {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return nil, false
+	}
+	return post, true
+}
+
+func validCommentContent(w http.ResponseWriter, content string) (string, bool) {
+	content = strings.TrimSpace(content)
+	if content == "" || utf8.RuneCountInString(content) > MaxCommentLength {
+		http.Error(w, "content must be between 1 and 2000 characters", http.StatusBadRequest)
+		return "", false
+	}
+	return content, true
+}
+
+func writeComment(w http.ResponseWriter, status int, comment *models.Comment) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(comment)
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+func InsertCommentHandler(s server.Server, repo repository.Repository, comments repository.CommentRepository, blocks repository.BlockRepository, notifier *notifications.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		insertRequest := InsertCommentRequest{}
+		err := json.NewDecoder(r.Body).Decode(&insertRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, ok := validCommentContent(w, insertRequest.Content)
+		if !ok {
+			return
+		}
+		post, ok := postFromPath(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		var parent *models.Comment
+		if insertRequest.ParentId != "" {
+			parent, err = comments.GetCommentById(r.Context(), insertRequest.ParentId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if parent.Id == "" || parent.PostId != post.Id {
+				http.Error(w, "parent comment not found", http.StatusBadRequest)
+				return
+			}
+		}
+		author, err := postAuthor(r, repo, principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		comment := models.Comment{
+			Id:       id.String(),
+			PostId:   post.Id,
+			ParentId: insertRequest.ParentId,
+			UserId:   principal.UserId,
+			Author:   author,
+			Content:  content,
+		}
+		err = comments.InsertComment(r.Context(), &comment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		publishToPost(r.Context(), s, blocks, post.Id, principal.UserId, models.WebsocketMessage{
+			Type:    "Comment_Created",
+			Payload: comment,
+		})
+		notifier.Notify(r.Context(), post.UserId, principal.UserId, models.NotificationComment, comment.Id)
+		if parent != nil && parent.UserId != post.UserId {
+			notifier.Notify(r.Context(), parent.UserId, principal.UserId, models.NotificationComment, comment.Id)
+		}
+		notifier.NotifyMentions(r.Context(), principal.UserId, comment.Id, comment.Content)
+
+		writeComment(w, http.StatusCreated, &comment)
+	}
+}
+
+// GetCommentsHandler lists the top level comments of a post, or the replies
+// to the comment given in the parentId query parameter.
+func GetCommentsHandler(s server.Server, repo repository.Repository, comments repository.CommentRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		post, ok := postFromPath(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		viewerId := ""
+		if principal, ok := server.PrincipalFromContext(r.Context()); ok {
+			viewerId = principal.UserId
+		}
+		items, err := comments.GetComments(r.Context(), viewerId, post.Id, r.URL.Query().Get("parentId"), cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page := Page{Items: items}
+		if len(items) == limit {
+			last := items[len(items)-1]
+			page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+		}
+		writePage(w, page)
+	}
+}
+
+func GetCommentHandler(s server.Server, repo repository.Repository, comments repository.CommentRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		post, ok := postFromPath(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		comment, err := comments.GetCommentById(r.Context(), mux.Vars(r)["commentId"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if comment.Id == "" || comment.PostId != post.Id {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		hidden, err := hiddenByBlock(r, blocks, comment.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hidden {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		writeComment(w, http.StatusOK, comment)
+	}
+}
+
+func UpdateCommentHandler(s server.Server, comments repository.CommentRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		updateRequest := UpdateCommentRequest{}
+		err := json.NewDecoder(r.Body).Decode(&updateRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, ok := validCommentContent(w, updateRequest.Content)
+		if !ok {
+			return
+		}
+		params := mux.Vars(r)
+		comment, err := comments.GetCommentById(r.Context(), params["commentId"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if comment.Id == "" || comment.PostId != params["id"] || comment.UserId != principal.UserId {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		comment.Content = content
+		updated, err := comments.UpdateComment(r.Context(), comment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !updated {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		publishToPost(r.Context(), s, blocks, comment.PostId, principal.UserId, models.WebsocketMessage{
+			Type:    "Comment_Updated",
+			Payload: comment,
+		})
+		writeComment(w, http.StatusOK, comment)
+	}
+}
+
+// DeleteCommentHandler removes a comment and its replies. Only the author may
+// delete a comment, unless the caller can delete any comment.
+func DeleteCommentHandler(s server.Server, comments repository.CommentRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		params := mux.Vars(r)
+		comment, err := comments.GetCommentById(r.Context(), params["commentId"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if comment.Id == "" || comment.PostId != params["id"] {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		var deleted bool
+		if principal.Can(server.PermissionCommentsDeleteAny) {
+			deleted, err = comments.DeleteAnyComment(r.Context(), comment.Id)
+		} else {
+			deleted, err = comments.DeleteComment(r.Context(), &models.Comment{Id: comment.Id, UserId: principal.UserId})
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "comment not found", http.StatusNotFound)
+			return
+		}
+		s.Hub().Publish(websockets.PostTopic(comment.PostId), models.WebsocketMessage{
+			Type:    "Comment_Deleted",
+			Payload: CommentDeletedEvent{Id: comment.Id, PostId: comment.PostId},
+		}, nil)
+		w.WriteHeader(http.StatusOK)
+	}
+}
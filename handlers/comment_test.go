@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidCommentContent(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"blank", "  ", false},
+		{"short", "nice post", true},
+		{"longest", strings.Repeat("a", MaxCommentLength), true},
+		{"too long", strings.Repeat("a", MaxCommentLength+1), false},
+		// the limit counts characters, not the bytes they take
+		{"longest multibyte", strings.Repeat("é", MaxCommentLength), true},
+		{"too long multibyte", strings.Repeat("é", MaxCommentLength+1), false},
+	}
+	for _, c := range cases {
+		_, valid := validCommentContent(httptest.NewRecorder(), c.content)
+		if valid != c.valid {
+			t.Errorf("%s: valid is %v, want %v", c.name, valid, c.valid)
+		}
+	}
+}
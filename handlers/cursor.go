@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"go-rest-websockets/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Page is a slice of a list paginated with an opaque cursor. NextCursor is
+// empty on the last page.
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+func encodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeCursor(r *http.Request) (*models.Cursor, error) {
+	value := r.URL.Query().Get("cursor")
+	if value == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(decoded), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &models.Cursor{CreatedAt: createdAt, Id: parts[1]}, nil
+}
+
+func pageLimit(r *http.Request) (int, error) {
+	limit, err := getIntQueryParam(r, "limit", DefaultPageLimit)
+	if err != nil || limit < 1 || limit > MaxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+	}
+	return limit, nil
+}
+
+// pageParams reads the cursor and limit query parameters.
+func pageParams(w http.ResponseWriter, r *http.Request) (*models.Cursor, int, bool) {
+	cursor, err := decodeCursor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, 0, false
+	}
+	limit, err := pageLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return cursor, limit, true
+}
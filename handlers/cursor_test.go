@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2022, 5, 13, 15, 4, 5, 123456789, time.FixedZone("CEST", 2*60*60))
+	ids := []string{"296xqz773X37kDQvHhiA8pJf0lQ", "with|separator", ""}
+	for _, id := range ids {
+		request := httptest.NewRequest("GET", "/posts?"+url.Values{"cursor": {encodeCursor(createdAt, id)}}.Encode(), nil)
+		cursor, err := decodeCursor(request)
+		if err != nil {
+			t.Fatalf("decoding cursor of %q: %v", id, err)
+		}
+		if !cursor.CreatedAt.Equal(createdAt) {
+			t.Errorf("createdAt is %v, want %v", cursor.CreatedAt, createdAt)
+		}
+		if cursor.Id != id {
+			t.Errorf("id is %q, want %q", cursor.Id, id)
+		}
+	}
+}
+
+func TestCursorIsOpaque(t *testing.T) {
+	cursor := encodeCursor(time.Unix(1652454245, 0), "296xqz773X37kDQvHhiA8pJf0lQ")
+	if url.QueryEscape(cursor) != cursor {
+		t.Fatalf("cursor %q needs escaping in a query string", cursor)
+	}
+}
+
+func TestDecodeCursorWithoutCursor(t *testing.T) {
+	cursor, err := decodeCursor(httptest.NewRequest("GET", "/posts", nil))
+	if err != nil || cursor != nil {
+		t.Fatalf("missing cursor decodes to %v, %v, want nil, nil", cursor, err)
+	}
+}
+
+func TestDecodeCursorRejectsInvalidCursors(t *testing.T) {
+	encode := base64.RawURLEncoding.EncodeToString
+	cursors := []string{
+		"not base64!",
+		encode([]byte("no separator")),
+		encode([]byte("yesterday|296xqz773X37kDQvHhiA8pJf0lQ")),
+	}
+	for _, value := range cursors {
+		request := httptest.NewRequest("GET", "/posts?"+url.Values{"cursor": {value}}.Encode(), nil)
+		if _, err := decodeCursor(request); err == nil {
+			t.Errorf("cursor %q accepted", value)
+		}
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	cases := []struct {
+		query string
+		limit int
+		valid bool
+	}{
+		{"", DefaultPageLimit, true},
+		{"limit=1", 1, true},
+		{"limit=100", MaxPageLimit, true},
+		{"limit=0", 0, false},
+		{"limit=101", 0, false},
+		{"limit=ten", 0, false},
+	}
+	for _, c := range cases {
+		limit, err := pageLimit(httptest.NewRequest("GET", "/posts?"+c.query, nil))
+		if (err == nil) != c.valid || limit != c.limit {
+			t.Errorf("%q gives %d, %v, want %d", c.query, limit, err, c.limit)
+		}
+	}
+}
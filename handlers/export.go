@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/exports"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+func setArchiveHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"export-%s.zip\"", time.Now().UTC().Format("20060102")))
+}
+
+func ExportHandler(s server.Server, exporter *exports.Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		large, err := exporter.IsLarge(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !large {
+			// the archive is built before answering, so a failure is reported
+			// as one instead of a truncated archive with a success status
+			archive := &bytes.Buffer{}
+			err = exporter.WriteArchive(r.Context(), archive, principal.UserId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			setArchiveHeaders(w)
+			w.Header().Set("Content-Length", strconv.Itoa(archive.Len()))
+			w.WriteHeader(http.StatusOK)
+			_, err = archive.WriteTo(w)
+			if err != nil {
+				log.Printf("error sending export archive %v", err)
+			}
+			return
+		}
+
+		export, err := exporter.Start(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/me/exports/"+export.Id)
+		w.WriteHeader(http.StatusAccepted)
+		err = json.NewEncoder(w).Encode(export)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func ExportStatusHandler(s server.Server, repo repository.DataExportRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		export, err := repo.GetDataExport(r.Context(), mux.Vars(r)["id"], principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if export.Id == "" {
+			http.Error(w, "export not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(export)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func ExportDownloadHandler(s server.Server, exporter *exports.Exporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		file, err := exporter.Open(r.Context(), mux.Vars(r)["id"], principal.UserId)
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "export not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		setArchiveHeaders(w)
+		w.WriteHeader(http.StatusOK)
+		_, err = io.Copy(w, file)
+		if err != nil {
+			log.Printf("error sending export archive %v", err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"go-rest-websockets/exports"
+	"go-rest-websockets/models"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// exportSource fails to load the user, so no archive can be written.
+type exportSource struct {
+	exports.Source
+}
+
+func (s *exportSource) CountPostsByUser(ctx context.Context, userId string) (int, error) {
+	return 0, nil
+}
+
+func (s *exportSource) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	return nil, errors.New("connection lost")
+}
+
+func TestExportHandlerReportsFailures(t *testing.T) {
+	exporter, err := exports.NewExporter(&exportSource{}, nil, t.TempDir(), 1000, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/me/export", nil)
+	request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+	recorder := httptest.NewRecorder()
+	ExportHandler(nil, exporter)(recorder, request)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status is %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType == "application/zip" {
+		t.Error("failed export answered with an archive")
+	}
+}
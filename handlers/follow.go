@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/notifications"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+func userByHandle(w http.ResponseWriter, r *http.Request, repo repository.Repository) (*models.User, bool) {
+	user, err := repo.GetUserByHandle(r.Context(), mux.Vars(r)["handle"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if user.Id == "" {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+func writePage(w http.ResponseWriter, page Page) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(page)
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+func FollowHandler(s server.Server, repo repository.Repository, follows repository.FollowRepository, blocks repository.BlockRepository, notifier *notifications.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, ok := userByHandle(w, r, repo)
+		if !ok {
+			return
+		}
+		if user.Id == principal.UserId {
+			http.Error(w, "cannot follow yourself", http.StatusBadRequest)
+			return
+		}
+		blocked, err := blocks.IsBlocked(r.Context(), principal.UserId, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "cannot follow this user", http.StatusForbidden)
+			return
+		}
+		created, err := follows.Follow(r.Context(), principal.UserId, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if created {
+			notifier.Notify(r.Context(), user.Id, principal.UserId, models.NotificationFollow, "")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func UnfollowHandler(s server.Server, repo repository.Repository, follows repository.FollowRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, ok := userByHandle(w, r, repo)
+		if !ok {
+			return
+		}
+		err := follows.Unfollow(r.Context(), principal.UserId, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func followPage(items []models.Follow, limit int) Page {
+	page := Page{Items: items}
+	if len(items) == limit {
+		last := items[len(items)-1]
+		page.NextCursor = encodeCursor(last.FollowedAt, last.Id)
+	}
+	return page
+}
+
+func GetFollowersHandler(s server.Server, repo repository.Repository, follows repository.FollowRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		user, ok := userByHandle(w, r, repo)
+		if !ok {
+			return
+		}
+		hidden, err := hiddenByBlock(r, blocks, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hidden {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		viewerId := ""
+		if principal, ok := server.PrincipalFromContext(r.Context()); ok {
+			viewerId = principal.UserId
+		}
+		followers, err := follows.GetFollowers(r.Context(), viewerId, user.Id, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writePage(w, followPage(followers, limit))
+	}
+}
+
+func GetFollowingHandler(s server.Server, repo repository.Repository, follows repository.FollowRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		user, ok := userByHandle(w, r, repo)
+		if !ok {
+			return
+		}
+		hidden, err := hiddenByBlock(r, blocks, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hidden {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		viewerId := ""
+		if principal, ok := server.PrincipalFromContext(r.Context()); ok {
+			viewerId = principal.UserId
+		}
+		following, err := follows.GetFollowing(r.Context(), viewerId, user.Id, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writePage(w, followPage(following, limit))
+	}
+}
+
+func postPage(items []models.Post, limit int) Page {
+	page := Page{Items: items}
+	if len(items) == limit {
+		last := items[len(items)-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+	}
+	return page
+}
+
+func TimelineHandler(s server.Server, follows repository.FollowRepository, reactions repository.ReactionRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		posts, err := follows.GetTimeline(r.Context(), principal.UserId, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = presentPostList(r, reactions, blocks, posts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writePage(w, postPage(posts, limit))
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// followRepository serves the follow lists of "user", who is blocked by
+// "blocked", and records the viewer the lists were read for.
+type followRepository struct {
+	repository.Repository
+	repository.FollowRepository
+	repository.BlockRepository
+	viewerId string
+}
+
+func (r *followRepository) GetUserByHandle(ctx context.Context, handle string) (*models.User, error) {
+	if handle != "user" {
+		return &models.User{}, nil
+	}
+	return &models.User{Id: "user"}, nil
+}
+
+func (r *followRepository) IsBlocked(ctx context.Context, userId string, otherUserId string) (bool, error) {
+	return userId == "blocked" && otherUserId == "user", nil
+}
+
+func (r *followRepository) GetFollowers(ctx context.Context, viewerId string, userId string, after *models.Cursor, limit int) ([]models.Follow, error) {
+	r.viewerId = viewerId
+	return []models.Follow{}, nil
+}
+
+func (r *followRepository) GetFollowing(ctx context.Context, viewerId string, userId string, after *models.Cursor, limit int) ([]models.Follow, error) {
+	r.viewerId = viewerId
+	return []models.Follow{}, nil
+}
+
+func TestFollowListsHideBlockedUsers(t *testing.T) {
+	repo := &followRepository{}
+	handlers := map[string]http.HandlerFunc{
+		"followers": GetFollowersHandler(nil, repo, repo, repo),
+		"following": GetFollowingHandler(nil, repo, repo, repo),
+	}
+	cases := []struct {
+		name   string
+		viewer string
+		handle string
+		status int
+	}{
+		{"anonymous", "", "user", http.StatusOK},
+		{"viewer", "viewer", "user", http.StatusOK},
+		{"blocked viewer", "blocked", "user", http.StatusNotFound},
+		{"missing user", "viewer", "missing", http.StatusNotFound},
+	}
+	for list, handler := range handlers {
+		for _, c := range cases {
+			repo.viewerId = "unset"
+			request := httptest.NewRequest(http.MethodGet, "/users/"+c.handle+"/"+list, nil)
+			request = mux.SetURLVars(request, map[string]string{"handle": c.handle})
+			if c.viewer != "" {
+				request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: c.viewer, TokenId: "token"}))
+			}
+			recorder := httptest.NewRecorder()
+			handler(recorder, request)
+			if recorder.Code != c.status {
+				t.Errorf("%s of %s: status is %d, want %d", list, c.name, recorder.Code, c.status)
+			}
+			// the repository leaves out the users hidden from the viewer
+			if c.status == http.StatusOK && repo.viewerId != c.viewer {
+				t.Errorf("%s of %s: listed for viewer %q, want %q", list, c.name, repo.viewerId, c.viewer)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const ImpersonationAuditLimit = 100
+
+type ImpersonationRequest struct {
+	ReadOnly *bool `json:"readOnly"`
+}
+
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	UserId    string    `json:"userId"`
+	ActorId   string    `json:"actorId"`
+	ReadOnly  bool      `json:"readOnly"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func authorizeImpersonation(w http.ResponseWriter, r *http.Request) (*server.Principal, bool) {
+	principal, ok := server.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !principal.Can(server.PermissionUsersImpersonate) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return principal, true
+}
+
+func ImpersonateUserHandler(s server.Server, repo repository.Repository, audit repository.ImpersonationAuditRepository, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := authorizeImpersonation(w, r)
+		if !ok {
+			return
+		}
+		impersonationRequest := ImpersonationRequest{}
+		err := json.NewDecoder(r.Body).Decode(&impersonationRequest)
+		if err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// impersonation is read only unless asked otherwise
+		readOnly := impersonationRequest.ReadOnly == nil || *impersonationRequest.ReadOnly
+
+		userId := mux.Vars(r)["id"]
+		if userId == actor.UserId {
+			http.Error(w, "cannot impersonate yourself", http.StatusBadRequest)
+			return
+		}
+		user, err := repo.GetUserById(r.Context(), userId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		user.Roles, err = repo.GetUserRoles(r.Context(), user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, role := range user.Roles {
+			if role == server.RoleAdmin {
+				http.Error(w, "admins cannot be impersonated", http.StatusForbidden)
+				return
+			}
+		}
+
+		token, claims, err := auth.SignImpersonationToken(actor, user, readOnly)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = audit.InsertImpersonationAuditEntry(r.Context(), &models.ImpersonationAuditEntry{
+			ActorId: actor.UserId,
+			UserId:  user.Id,
+			TokenId: claims.Id,
+			Method:  r.Method,
+			Path:    r.URL.RequestURI(),
+			Status:  http.StatusCreated,
+			Ip:      clientIP(r),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(ImpersonationResponse{
+			Token:     token,
+			UserId:    user.Id,
+			ActorId:   actor.UserId,
+			ReadOnly:  readOnly,
+			ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		})
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func GetImpersonationAuditHandler(s server.Server, audit repository.ImpersonationAuditRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeImpersonation(w, r); !ok {
+			return
+		}
+		entries, err := audit.GetImpersonationAuditByUser(r.Context(), mux.Vars(r)["id"], ImpersonationAuditLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(entries)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// impersonationRepository knows a regular user and an admin and keeps the
+// audit entries written.
+type impersonationRepository struct {
+	repository.Repository
+	repository.ImpersonationAuditRepository
+	entries []models.ImpersonationAuditEntry
+}
+
+func (r *impersonationRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	if id != "user" && id != "other-admin" {
+		return &models.User{}, nil
+	}
+	return &models.User{Id: id}, nil
+}
+
+func (r *impersonationRepository) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	if userId == "other-admin" {
+		return []string{server.RoleAdmin}, nil
+	}
+	return []string{}, nil
+}
+
+func (r *impersonationRepository) InsertImpersonationAuditEntry(ctx context.Context, entry *models.ImpersonationAuditEntry) error {
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+func impersonate(t *testing.T, auth server.Authorization, repo *impersonationRepository, principal *server.Principal, userId string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/admin/users/"+userId+"/impersonate", strings.NewReader(body))
+	request = mux.SetURLVars(request, map[string]string{"id": userId})
+	request = request.WithContext(server.WithPrincipal(request.Context(), principal))
+	recorder := httptest.NewRecorder()
+	ImpersonateUserHandler(nil, repo, repo, auth)(recorder, request)
+	return recorder
+}
+
+func TestImpersonationIsReadOnlyByDefault(t *testing.T) {
+	auth := newTestAuthorization(t)
+	repo := &impersonationRepository{}
+	admin := &server.Principal{UserId: "admin", Roles: []string{server.RoleAdmin}, TokenId: "token"}
+	cases := []struct {
+		name     string
+		body     string
+		readOnly bool
+	}{
+		{"without body", "", true},
+		{"without readOnly", `{}`, true},
+		{"read only", `{"readOnly":true}`, true},
+		{"read write", `{"readOnly":false}`, false},
+	}
+	for _, c := range cases {
+		recorder := impersonate(t, auth, repo, admin, "user", c.body)
+		if recorder.Code != http.StatusCreated {
+			t.Fatalf("%s: status is %d, want %d", c.name, recorder.Code, http.StatusCreated)
+		}
+		response := ImpersonationResponse{}
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.ReadOnly != c.readOnly {
+			t.Errorf("%s: response read only is %v, want %v", c.name, response.ReadOnly, c.readOnly)
+		}
+		// the token itself carries the restriction the middleware enforces
+		claims, err := auth.ParseAndVerifyToken(response.Token)
+		if err != nil {
+			t.Fatalf("%s: parsing token: %v", c.name, err)
+		}
+		principal := auth.Principal(claims)
+		if principal.ReadOnly != c.readOnly || principal.ActorId != "admin" || principal.UserId != "user" {
+			t.Errorf("%s: token principal is %+v", c.name, principal)
+		}
+	}
+	if len(repo.entries) != len(cases) {
+		t.Errorf("%d impersonations audited, want %d", len(repo.entries), len(cases))
+	}
+}
+
+func TestImpersonateUserHandlerRejects(t *testing.T) {
+	auth := newTestAuthorization(t)
+	repo := &impersonationRepository{}
+	admin := &server.Principal{UserId: "admin", Roles: []string{server.RoleAdmin}, TokenId: "token"}
+	moderator := &server.Principal{UserId: "moderator", Roles: []string{server.RoleModerator}, TokenId: "token"}
+	cases := []struct {
+		name      string
+		principal *server.Principal
+		userId    string
+		status    int
+	}{
+		{"moderator", moderator, "user", http.StatusForbidden},
+		{"yourself", admin, "admin", http.StatusBadRequest},
+		{"missing user", admin, "missing", http.StatusNotFound},
+		{"admin", admin, "other-admin", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		recorder := impersonate(t, auth, repo, c.principal, c.userId, "")
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+	if len(repo.entries) != 0 {
+		t.Errorf("%d rejected impersonations audited", len(repo.entries))
+	}
+}
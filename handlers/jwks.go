@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+func JWKSHandler(s server.Server, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		err := json.NewEncoder(w).Encode(auth.JWKS())
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
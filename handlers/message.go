@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const MaxMessageLength = 2000
+
+type StartConversationRequest struct {
+	Handle string `json:"handle"`
+}
+
+type SendMessageRequest struct {
+	Body string `json:"body"`
+}
+
+type ConversationReadEvent struct {
+	ConversationId string    `json:"conversationId"`
+	UserId         string    `json:"userId"`
+	ReadAt         time.Time `json:"readAt"`
+}
+
+func writeConversation(w http.ResponseWriter, status int, conversation *models.Conversation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(conversation)
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+// conversationFromPath loads the conversation named in the path, answering 404
+// when the caller does not take part in it.
+func conversationFromPath(w http.ResponseWriter, r *http.Request, messages repository.MessageRepository, userId string) (*models.Conversation, bool) {
+	conversation, err := messages.GetConversation(r.Context(), mux.Vars(r)["id"], userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if conversation.Id == "" {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return nil, false
+	}
+	return conversation, true
+}
+
+// blockedInConversation reports whether a block stands between userId and any
+// other participant of the conversation.
+func blockedInConversation(r *http.Request, blocks repository.BlockRepository, conversation *models.Conversation, userId string) (bool, error) {
+	for _, participant := range conversation.Participants {
+		if participant.Id == userId {
+			continue
+		}
+		blocked, err := blocks.IsBlocked(r.Context(), userId, participant.Id)
+		if err != nil || blocked {
+			return blocked, err
+		}
+	}
+	return false, nil
+}
+
+func StartConversationHandler(s server.Server, repo repository.Repository, messages repository.MessageRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		startRequest := StartConversationRequest{}
+		err := json.NewDecoder(r.Body).Decode(&startRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, err := repo.GetUserByHandle(r.Context(), startRequest.Handle)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		if user.Id == principal.UserId {
+			http.Error(w, "cannot message yourself", http.StatusBadRequest)
+			return
+		}
+		blocked, err := blocks.IsBlocked(r.Context(), principal.UserId, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "cannot message this user", http.StatusForbidden)
+			return
+		}
+		conversation, err := messages.GetOrCreateDirectConversation(r.Context(), principal.UserId, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeConversation(w, http.StatusOK, conversation)
+	}
+}
+
+func GetConversationsHandler(s server.Server, messages repository.MessageRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		conversations, err := messages.GetConversations(r.Context(), principal.UserId, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page := Page{Items: conversations}
+		if len(conversations) == limit {
+			last := conversations[len(conversations)-1]
+			page.NextCursor = encodeCursor(last.LastMessageAt, last.Id)
+		}
+		writePage(w, page)
+	}
+}
+
+func GetConversationHandler(s server.Server, messages repository.MessageRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conversation, ok := conversationFromPath(w, r, messages, principal.UserId)
+		if !ok {
+			return
+		}
+		writeConversation(w, http.StatusOK, conversation)
+	}
+}
+
+func GetMessagesHandler(s server.Server, messages repository.MessageRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		conversation, ok := conversationFromPath(w, r, messages, principal.UserId)
+		if !ok {
+			return
+		}
+		history, err := messages.GetMessages(r.Context(), conversation.Id, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page := Page{Items: history}
+		if len(history) == limit {
+			last := history[len(history)-1]
+			page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+		}
+		writePage(w, page)
+	}
+}
+
+func validMessageBody(w http.ResponseWriter, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > MaxMessageLength {
+		http.Error(w, "body must be between 1 and 2000 characters", http.StatusBadRequest)
+		return "", false
+	}
+	return body, true
+}
+
+// SendMessageHandler stores a message and delivers it over websockets to the
+// participants of the conversation only, including the sender's other sessions.
+func SendMessageHandler(s server.Server, messages repository.MessageRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		sendRequest := SendMessageRequest{}
+		err := json.NewDecoder(r.Body).Decode(&sendRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, ok := validMessageBody(w, sendRequest.Body)
+		if !ok {
+			return
+		}
+		conversation, ok := conversationFromPath(w, r, messages, principal.UserId)
+		if !ok {
+			return
+		}
+		blocked, err := blockedInConversation(r, blocks, conversation, principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "cannot message this user", http.StatusForbidden)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		message := models.Message{
+			Id:             id.String(),
+			ConversationId: conversation.Id,
+			SenderId:       principal.UserId,
+			Body:           body,
+		}
+		err = messages.InsertMessage(r.Context(), &message)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.Hub().SendToUsers(conversation.ParticipantIds(), models.WebsocketMessage{
+			Type:    "Message_Created",
+			Payload: message,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(message)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+// MarkConversationReadHandler records that the caller has read the
+// conversation up to now and sends the read receipt to the participants.
+func MarkConversationReadHandler(s server.Server, messages repository.MessageRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conversation, ok := conversationFromPath(w, r, messages, principal.UserId)
+		if !ok {
+			return
+		}
+		readAt, err := messages.MarkConversationRead(r.Context(), conversation.Id, principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		event := ConversationReadEvent{ConversationId: conversation.Id, UserId: principal.UserId, ReadAt: readAt}
+		s.Hub().SendToUsers(conversation.ParticipantIds(), models.WebsocketMessage{
+			Type:    "Conversation_Read",
+			Payload: event,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(event)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidMessageBody(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{"blank", "  ", false},
+		{"short", "hello", true},
+		{"too long", strings.Repeat("a", MaxMessageLength+1), false},
+		// the limit counts characters, not the bytes they take
+		{"longest multibyte", strings.Repeat("é", MaxMessageLength), true},
+		{"too long multibyte", strings.Repeat("é", MaxMessageLength+1), false},
+	}
+	for _, c := range cases {
+		_, valid := validMessageBody(httptest.NewRecorder(), c.body)
+		if valid != c.valid {
+			t.Errorf("%s: valid is %v, want %v", c.name, valid, c.valid)
+		}
+	}
+}
+
+// messageRepository holds a conversation between alice and bob and, like the
+// database, only finds it for its participants.
+type messageRepository struct {
+	repository.MessageRepository
+	repository.BlockRepository
+	conversation models.Conversation
+	messages     []models.Message
+	reads        []string
+}
+
+func newMessageRepository() *messageRepository {
+	return &messageRepository{conversation: models.Conversation{
+		Id: "conversation",
+		Participants: []models.Participant{
+			{Author: models.Author{Id: "alice"}},
+			{Author: models.Author{Id: "bob"}},
+		},
+	}}
+}
+
+func (r *messageRepository) GetConversation(ctx context.Context, id string, userId string) (*models.Conversation, error) {
+	if id != r.conversation.Id || !r.conversation.HasParticipant(userId) {
+		return &models.Conversation{}, nil
+	}
+	conversation := r.conversation
+	return &conversation, nil
+}
+
+func (r *messageRepository) GetMessages(ctx context.Context, conversationId string, after *models.Cursor, limit int) ([]models.Message, error) {
+	return r.messages, nil
+}
+
+func (r *messageRepository) InsertMessage(ctx context.Context, message *models.Message) error {
+	r.messages = append(r.messages, *message)
+	return nil
+}
+
+func (r *messageRepository) MarkConversationRead(ctx context.Context, conversationId string, userId string) (time.Time, error) {
+	r.reads = append(r.reads, userId)
+	return time.Now(), nil
+}
+
+func (r *messageRepository) IsBlocked(ctx context.Context, userId string, otherUserId string) (bool, error) {
+	return false, nil
+}
+
+func TestConversationsAreForParticipantsOnly(t *testing.T) {
+	repo := newMessageRepository()
+	s := testServer{config: &server.Config{}, hub: websockets.NewHub()}
+	routes := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{"conversation", http.MethodGet, GetConversationHandler(s, repo), http.StatusOK},
+		{"messages", http.MethodGet, GetMessagesHandler(s, repo), http.StatusOK},
+		{"send", http.MethodPost, SendMessageHandler(s, repo, repo), http.StatusCreated},
+		{"read", http.MethodPost, MarkConversationReadHandler(s, repo), http.StatusOK},
+	}
+	cases := []struct {
+		name   string
+		userId string
+		id     string
+		found  bool
+	}{
+		{"participant", "alice", "conversation", true},
+		{"other participant", "bob", "conversation", true},
+		{"outsider", "mallory", "conversation", false},
+		{"missing conversation", "alice", "missing", false},
+	}
+	for _, route := range routes {
+		for _, c := range cases {
+			request := httptest.NewRequest(route.method, "/conversations/"+c.id, strings.NewReader(`{"body":"hi"}`))
+			request = mux.SetURLVars(request, map[string]string{"id": c.id})
+			request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: c.userId, TokenId: "token"}))
+			recorder := httptest.NewRecorder()
+			route.handler(recorder, request)
+			want := http.StatusNotFound
+			if c.found {
+				want = route.status
+			}
+			if recorder.Code != want {
+				t.Errorf("%s by %s: status is %d, want %d", route.name, c.name, recorder.Code, want)
+			}
+		}
+	}
+	for _, message := range repo.messages {
+		if message.SenderId != "alice" && message.SenderId != "bob" {
+			t.Errorf("message sent by %s", message.SenderId)
+		}
+	}
+	for _, userId := range repo.reads {
+		if userId != "alice" && userId != "bob" {
+			t.Errorf("conversation marked read by %s", userId)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+	"time"
+)
+
+type TotpEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioningUri"`
+}
+
+type SecondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfaToken"`
+	SecondFactorRequest
+}
+
+// verifyTotp accepts each code once, a code seen before is rejected even if
+// it is still within its period.
+func verifyTotp(ctx context.Context, mfa repository.MFARepository, user *models.User, code string) (bool, error) {
+	counter, ok := server.VerifyTOTP(user.TotpSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return mfa.UseTotpCounter(ctx, user.Id, counter)
+}
+
+func verifySecondFactor(ctx context.Context, mfa repository.MFARepository, user *models.User, factor SecondFactorRequest) (bool, error) {
+	if factor.Code != "" {
+		return verifyTotp(ctx, mfa, user, factor.Code)
+	}
+	if factor.RecoveryCode != "" {
+		return mfa.ConsumeRecoveryCode(ctx, user.Id, server.HashRecoveryCode(factor.RecoveryCode))
+	}
+	return false, nil
+}
+
+func EnrollTotpHandler(s server.Server, repo repository.Repository, mfa repository.MFARepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := repo.GetUserById(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.TotpEnabled {
+			http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		secret, err := server.GenerateTOTPSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = mfa.SetUserTotpSecret(r.Context(), user.Id, secret)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(TotpEnrollmentResponse{
+			Secret:          secret,
+			ProvisioningUri: server.TOTPProvisioningURI(s.Config().TOTPIssuer, user.Email, secret),
+		})
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func ConfirmTotpHandler(s server.Server, repo repository.Repository, mfa repository.MFARepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		confirmRequest := SecondFactorRequest{}
+		err := json.NewDecoder(r.Body).Decode(&confirmRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, err := repo.GetUserById(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.TotpEnabled {
+			http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		if user.TotpSecret == "" {
+			http.Error(w, "two-factor enrollment has not been started", http.StatusBadRequest)
+			return
+		}
+		valid, err := verifyTotp(r.Context(), mfa, user, confirmRequest.Code)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			http.Error(w, "invalid code", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := server.GenerateRecoveryCodes()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		hashes := make([]string, 0, len(codes))
+		for _, code := range codes {
+			hashes = append(hashes, server.HashRecoveryCode(code))
+		}
+		err = mfa.EnableUserTotp(r.Context(), user.Id, hashes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+// DisableTotpHandler shares the second factor throttle with the login, so a
+// stolen session cannot guess its way to turning two-factor off.
+func DisableTotpHandler(s server.Server, repo repository.Repository, mfa repository.MFARepository, throttle *server.LoginThrottle, events repository.AuthEventRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		disableRequest := SecondFactorRequest{}
+		err := json.NewDecoder(r.Body).Decode(&disableRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, err := repo.GetUserById(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !user.TotpEnabled {
+			http.Error(w, "two-factor authentication is not enabled", http.StatusConflict)
+			return
+		}
+		mfaKey := server.ThrottleKey(server.ThrottleMFA, user.Id)
+		if wait := throttle.Check(mfaKey); wait > 0 {
+			recordAuthEvent(r.Context(), events, r, models.AuthEventMFAThrottled, user.Id, user.Email)
+			tooManyAttempts(w, wait)
+			return
+		}
+		verified, err := verifySecondFactor(r.Context(), mfa, user, disableRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			recordAuthEvent(r.Context(), events, r, models.AuthEventMFAFailed, user.Id, user.Email)
+			http.Error(w, "invalid code", http.StatusBadRequest)
+			return
+		}
+		throttle.Success(mfaKey)
+		err = mfa.DisableUserTotp(r.Context(), user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAuthEvent(r.Context(), events, r, models.AuthEventMFADisabled, user.Id, user.Email)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func LoginMFAHandler(s server.Server, repo repository.Repository, mfa repository.MFARepository, auth server.Authorization, throttle *server.LoginThrottle, events repository.AuthEventRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loginRequest := LoginMFARequest{}
+		err := json.NewDecoder(r.Body).Decode(&loginRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		claims, err := auth.ParseAndVerifyMFAChallenge(loginRequest.MFAToken)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		mfaKey := server.ThrottleKey(server.ThrottleMFA, claims.UserId)
+		if wait := throttle.Check(mfaKey); wait > 0 {
+			recordAuthEvent(r.Context(), events, r, models.AuthEventLoginThrottled, claims.UserId, "")
+			tooManyAttempts(w, wait)
+			return
+		}
+		user, err := repo.GetUserById(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !user.TotpEnabled {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		verified, err := verifySecondFactor(r.Context(), mfa, user, loginRequest.SecondFactorRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			recordAuthEvent(r.Context(), events, r, models.AuthEventMFAFailed, user.Id, user.Email)
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		throttle.Success(mfaKey)
+		// the challenge is single use
+		err = auth.RevokeToken(r.Context(), auth.Principal(claims))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		recordAuthEvent(r.Context(), events, r, models.AuthEventLoginSucceeded, user.Id, user.Email)
+		issueLoginToken(w, r, s, repo, auth, user, wantsSessionCookie(s, r))
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRecoveryCode = "recovery-code"
+
+// mfaRepository serves a user with two-factor enabled and records the auth
+// events and whether two-factor was turned off.
+type mfaRepository struct {
+	repository.Repository
+	repository.MFARepository
+	disabled bool
+	events   []string
+}
+
+func (r *mfaRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	return &models.User{Id: id, TotpEnabled: true, TotpSecret: "JBSWY3DPEHPK3PXP"}, nil
+}
+
+func (r *mfaRepository) UseTotpCounter(ctx context.Context, userId string, counter int64) (bool, error) {
+	return true, nil
+}
+
+func (r *mfaRepository) ConsumeRecoveryCode(ctx context.Context, userId string, codeHash string) (bool, error) {
+	return codeHash == server.HashRecoveryCode(testRecoveryCode), nil
+}
+
+func (r *mfaRepository) DisableUserTotp(ctx context.Context, userId string) error {
+	r.disabled = true
+	return nil
+}
+
+func (r *mfaRepository) InsertAuthEvent(ctx context.Context, event *models.AuthEvent) error {
+	r.events = append(r.events, event.Event)
+	return nil
+}
+
+func (r *mfaRepository) ForEachAuthEventByUser(ctx context.Context, userId string, fn func(event models.AuthEvent) error) error {
+	return nil
+}
+
+func TestDisableTotpHandlerIsThrottled(t *testing.T) {
+	repo := &mfaRepository{}
+	throttle := server.NewLoginThrottle(map[string]server.ThrottleConfig{
+		server.ThrottleMFA: {FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, ForgetAfter: time.Hour},
+	})
+	handler := DisableTotpHandler(nil, repo, repo, throttle, repo)
+	principal := &server.Principal{UserId: "user", TokenId: "token"}
+	disable := func(body string) int {
+		request := httptest.NewRequest(http.MethodDelete, "/me/mfa/totp", strings.NewReader(body))
+		request = request.WithContext(server.WithPrincipal(request.Context(), principal))
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder.Code
+	}
+
+	// the free attempts, then backoff
+	statuses := []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest, http.StatusTooManyRequests}
+	for attempt, status := range statuses {
+		if got := disable(`{"code":"000000"}`); got != status {
+			t.Errorf("attempt %d: status is %d, want %d", attempt+1, got, status)
+		}
+	}
+	// once throttled even a right code has to wait
+	if got := disable(`{"recoveryCode":"` + testRecoveryCode + `"}`); got != http.StatusTooManyRequests {
+		t.Errorf("right code while throttled: status is %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if repo.disabled {
+		t.Error("two-factor was disabled")
+	}
+	want := []string{models.AuthEventMFAFailed, models.AuthEventMFAFailed, models.AuthEventMFAFailed, models.AuthEventMFAFailed, models.AuthEventMFAThrottled, models.AuthEventMFAThrottled}
+	if strings.Join(repo.events, ",") != strings.Join(want, ",") {
+		t.Errorf("events are %v, want %v", repo.events, want)
+	}
+}
+
+func TestDisableTotpHandler(t *testing.T) {
+	repo := &mfaRepository{}
+	throttle := server.NewLoginThrottle(map[string]server.ThrottleConfig{
+		server.ThrottleMFA: {FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, ForgetAfter: time.Hour},
+	})
+	request := httptest.NewRequest(http.MethodDelete, "/me/mfa/totp", strings.NewReader(`{"recoveryCode":"`+testRecoveryCode+`"}`))
+	request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+	recorder := httptest.NewRecorder()
+	DisableTotpHandler(nil, repo, repo, throttle, repo)(recorder, request)
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("status is %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+	if !repo.disabled {
+		t.Error("two-factor was not disabled")
+	}
+	if len(repo.events) != 1 || repo.events[0] != models.AuthEventMFADisabled {
+		t.Errorf("events are %v, want %s", repo.events, models.AuthEventMFADisabled)
+	}
+}
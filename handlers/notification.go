@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+type NotificationPage struct {
+	Page
+	UnreadCount int `json:"unreadCount"`
+}
+
+type UnreadCountResponse struct {
+	UnreadCount int `json:"unreadCount"`
+}
+
+type MarkNotificationsReadRequest struct {
+	Ids []string `json:"ids"`
+}
+
+func writeUnreadCount(w http.ResponseWriter, r *http.Request, repo repository.NotificationRepository, userId string) {
+	unread, err := repo.CountUnreadNotifications(r.Context(), userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(UnreadCountResponse{UnreadCount: unread})
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+func GetNotificationsHandler(s server.Server, repo repository.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		cursor, limit, ok := pageParams(w, r)
+		if !ok {
+			return
+		}
+		unreadOnly := r.URL.Query().Get("unread") == "true"
+		notifications, err := repo.GetNotifications(r.Context(), principal.UserId, unreadOnly, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		unread, err := repo.CountUnreadNotifications(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		page := NotificationPage{Page: Page{Items: notifications}, UnreadCount: unread}
+		if len(notifications) == limit {
+			last := notifications[len(notifications)-1]
+			page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func GetUnreadNotificationCountHandler(s server.Server, repo repository.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		writeUnreadCount(w, r, repo, principal.UserId)
+	}
+}
+
+// MarkNotificationsReadHandler marks the listed notifications as read and
+// answers with the remaining unread count.
+func MarkNotificationsReadHandler(s server.Server, repo repository.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		markRequest := MarkNotificationsReadRequest{}
+		err := json.NewDecoder(r.Body).Decode(&markRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(markRequest.Ids) == 0 || len(markRequest.Ids) > MaxPageLimit {
+			http.Error(w, "ids must list between 1 and 100 notifications", http.StatusBadRequest)
+			return
+		}
+		err = repo.MarkNotificationsRead(r.Context(), principal.UserId, markRequest.Ids)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeUnreadCount(w, r, repo, principal.UserId)
+	}
+}
+
+func MarkAllNotificationsReadHandler(s server.Server, repo repository.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := repo.MarkAllNotificationsRead(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeUnreadCount(w, r, repo, principal.UserId)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// notificationRepository counts the unread notifications of "user" and
+// records which were marked read by whom.
+type notificationRepository struct {
+	repository.NotificationRepository
+	unread map[string]bool
+	reader string
+}
+
+func (r *notificationRepository) MarkNotificationsRead(ctx context.Context, userId string, ids []string) error {
+	r.reader = userId
+	for _, id := range ids {
+		delete(r.unread, id)
+	}
+	return nil
+}
+
+func (r *notificationRepository) CountUnreadNotifications(ctx context.Context, userId string) (int, error) {
+	return len(r.unread), nil
+}
+
+func TestMarkNotificationsReadHandler(t *testing.T) {
+	tooMany := make([]string, 0, MaxPageLimit+1)
+	for i := 0; i <= MaxPageLimit; i++ {
+		tooMany = append(tooMany, fmt.Sprintf(`"%d"`, i))
+	}
+	cases := []struct {
+		name   string
+		body   string
+		status int
+		unread int
+	}{
+		{"without ids", `{"ids":[]}`, http.StatusBadRequest, 0},
+		{"too many ids", `{"ids":[` + strings.Join(tooMany, ",") + `]}`, http.StatusBadRequest, 0},
+		{"some ids", `{"ids":["first"]}`, http.StatusOK, 1},
+	}
+	for _, c := range cases {
+		repo := &notificationRepository{unread: map[string]bool{"first": true, "second": true}}
+		request := httptest.NewRequest(http.MethodPost, "/notifications/read", strings.NewReader(c.body))
+		request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+		recorder := httptest.NewRecorder()
+		MarkNotificationsReadHandler(nil, repo)(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			if repo.reader != "" {
+				t.Errorf("%s: notifications marked read", c.name)
+			}
+			continue
+		}
+		// only the caller's notifications can be marked
+		if repo.reader != "user" {
+			t.Errorf("%s: marked read for %q, want user", c.name, repo.reader)
+		}
+		response := UnreadCountResponse{}
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.UnreadCount != c.unread {
+			t.Errorf("%s: unread count is %d, want %d", c.name, response.UnreadCount, c.unread)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+func OIDCLoginHandler(s server.Server, provider *server.OIDCProvider, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		login, location, err := provider.StartLogin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		token, err := auth.SignOIDCLogin(login)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		server.SetOIDCLoginCookie(w, s.Config().SessionCookies, token)
+		http.Redirect(w, r, location, http.StatusFound)
+	}
+}
+
+func OIDCCallbackHandler(s server.Server, repo repository.Repository, identities repository.IdentityRepository, provider *server.OIDCProvider, auth server.Authorization, events repository.AuthEventRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server.ClearOIDCLoginCookie(w, s.Config().SessionCookies)
+		query := r.URL.Query()
+		if query.Get("error") != "" {
+			http.Error(w, "login was not completed: "+query.Get("error"), http.StatusUnauthorized)
+			return
+		}
+
+		// the state must come back to the browser that started the login,
+		// otherwise anyone could sign a victim in to their own account
+		cookie, err := r.Cookie(server.OIDCLoginCookieName)
+		if err != nil {
+			http.Error(w, "invalid login", http.StatusUnauthorized)
+			return
+		}
+		login, err := auth.ParseOIDCLogin(cookie.Value)
+		if err != nil || subtle.ConstantTimeCompare([]byte(login.State), []byte(query.Get("state"))) != 1 {
+			http.Error(w, "invalid login", http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := provider.Exchange(r.Context(), login, query.Get("code"))
+		if err != nil {
+			log.Printf("error completing oidc login %v", err)
+			http.Error(w, "invalid login", http.StatusUnauthorized)
+			return
+		}
+
+		user, status, err := resolveIdentityUser(r, repo, identities, events, identity)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		// the callback is a browser navigation, so it always uses the cookie when enabled
+		completeLogin(w, r, s, repo, auth, events, user, s.Config().SessionCookies.Enabled)
+	}
+}
+
+// resolveIdentityUser returns the user the external identity signs in as,
+// creating the account on first login. An identity is only linked to an
+// existing account when both sides verified the email address, otherwise
+// anyone controlling either side could take the other over.
+func resolveIdentityUser(r *http.Request, repo repository.Repository, identities repository.IdentityRepository, events repository.AuthEventRepository, identity *server.OIDCIdentity) (*models.User, int, error) {
+	ctx := r.Context()
+	linked, err := identities.GetIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if linked.UserId != "" {
+		user, err := repo.GetUserById(ctx, linked.UserId)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return user, http.StatusOK, nil
+	}
+
+	if identity.Email == "" || validateEmail(identity.Email) != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("identity provider did not return a valid email address")
+	}
+	link := &models.Identity{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	}
+
+	existing, err := repo.GetUserByEmail(ctx, identity.Email)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if existing.Id != "" {
+		if !identity.EmailVerified || !existing.EmailVerified {
+			return nil, http.StatusConflict, fmt.Errorf("an account with this email already exists")
+		}
+		link.UserId = existing.Id
+		err = identities.InsertIdentity(ctx, link)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		recordAuthEvent(ctx, events, r, models.AuthEventIdentityLinked, existing.Id, identity.Email)
+		return existing, http.StatusOK, nil
+	}
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	// Accounts created through the provider have no password; bcrypt rejects
+	// the empty hash, so password login stays closed until one is reset.
+	user := &models.User{
+		Id:            id.String(),
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+	}
+	err = identities.InsertUserWithIdentity(ctx, user, link)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	recordAuthEvent(ctx, events, r, models.AuthEventIdentityLinked, user.Id, identity.Email)
+	return user, http.StatusOK, nil
+}
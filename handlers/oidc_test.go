@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	config *server.Config
+	hub    *websockets.Hub
+}
+
+func (s testServer) Config() *server.Config {
+	return s.config
+}
+
+func (s testServer) Hub() *websockets.Hub {
+	return s.hub
+}
+
+func newTestAuthorization(t *testing.T) server.Authorization {
+	t.Helper()
+	keys, err := server.LoadKeySet(t.TempDir(), server.AlgorithmEdDSA, 3*time.Hour, 2*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.NewAuthorization(keys, server.NewRevocationStore(nil, websockets.NewHub()), nil, nil)
+}
+
+func TestOIDCCallbackRequiresLoginOfTheBrowser(t *testing.T) {
+	auth := newTestAuthorization(t)
+	cookie, err := auth.SignOIDCLogin(&server.OIDCLogin{State: "state", Nonce: "nonce", Verifier: "verifier"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		state  string
+		cookie string
+	}{
+		{"without login cookie", "state", ""},
+		// a callback url handed to the victim carries the attacker's state
+		{"state of another login", "attacker", cookie},
+		{"forged login cookie", "state", "state"},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?code=code&state="+c.state, nil)
+		if c.cookie != "" {
+			request.AddCookie(&http.Cookie{Name: server.OIDCLoginCookieName, Value: c.cookie})
+		}
+		recorder := httptest.NewRecorder()
+		OIDCCallbackHandler(testServer{config: &server.Config{}}, nil, nil, nil, auth, nil)(recorder, request)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-rest-websockets/mailer"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"golang.org/x/crypto/bcrypt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	MinPasswordLength        = 8
+	PasswordResetExpires     = time.Hour
+	EmailVerificationExpires = 24 * time.Hour
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func validatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must have at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
+// ForgotPasswordHandler mails a reset link. Every request counts against the
+// email address and the client address, whether the account exists or not, so
+// the endpoint cannot be used to flood a mailbox.
+func ForgotPasswordHandler(s server.Server, repo repository.Repository, tokens repository.UserTokenRepository, mail mailer.Mailer, throttle *server.LoginThrottle, events repository.AuthEventRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		forgotRequest := ForgotPasswordRequest{}
+		err := json.NewDecoder(r.Body).Decode(&forgotRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		emailKey := server.ThrottleKey(server.ThrottleResetEmail, forgotRequest.Email)
+		ipKey := server.ThrottleKey(server.ThrottleResetIP, clientIP(r))
+		if wait := throttle.Check(emailKey, ipKey); wait > 0 {
+			tooManyAttempts(w, wait)
+			return
+		}
+
+		user, err := repo.GetUserByEmail(r.Context(), forgotRequest.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// answer the same way and as fast whether the account exists or not
+		if user.Id != "" {
+			go sendPasswordReset(r, s, tokens, mail, events, user)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// sendPasswordReset runs after the request was answered, so it does not use
+// the request context.
+func sendPasswordReset(r *http.Request, s server.Server, tokens repository.UserTokenRepository, mail mailer.Mailer, events repository.AuthEventRepository, user *models.User) {
+	ctx := context.Background()
+	recordAuthEvent(ctx, events, r, models.AuthEventPasswordResetRequested, user.Id, user.Email)
+	secret, err := issueUserToken(ctx, tokens, user.Id, models.UserTokenPasswordReset, "", PasswordResetExpires)
+	if err != nil {
+		log.Printf("error issuing password reset token %v", err)
+		return
+	}
+	err = mail.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Use the following link to choose a new password. It expires in %v.\n\n%s\n\nIf you did not ask for this, ignore this email.", PasswordResetExpires, userTokenLink(s, "/password/reset", secret)),
+	})
+	if err != nil {
+		log.Printf("error sending password reset email %v", err)
+	}
+}
+
+func ResetPasswordHandler(s server.Server, repo repository.Repository, tokens repository.UserTokenRepository, auth server.Authorization, events repository.AuthEventRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resetRequest := ResetPasswordRequest{}
+		err := json.NewDecoder(r.Body).Decode(&resetRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = validatePassword(resetRequest.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token, err := tokens.ConsumeUserToken(r.Context(), models.UserTokenPasswordReset, server.HashSecret(resetRequest.Token))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if token.Id == "" {
+			http.Error(w, "reset token is invalid or has expired", http.StatusBadRequest)
+			return
+		}
+
+		hashed, err := bcrypt.GenerateFromPassword([]byte(resetRequest.Password), HashCost)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = repo.UpdateUserPassword(r.Context(), token.UserId, string(hashed))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = auth.RevokeUserCredentials(r.Context(), token.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recordAuthEvent(r.Context(), events, r, models.AuthEventPasswordReset, token.UserId, "")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+var resetPasswordForm = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Reset your password</title></head>
+<body>
+<form id="reset">
+<label>New password <input type="password" name="password" minlength="{{.MinLength}}" required></label>
+<button type="submit">Reset password</button>
+</form>
+<p id="result"></p>
+<script>
+document.getElementById("reset").addEventListener("submit", function (event) {
+	event.preventDefault();
+	fetch("/password/reset", {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify({token: {{.Token}}, password: event.target.password.value})
+	}).then(function (response) {
+		if (response.ok) {
+			document.getElementById("reset").remove();
+			document.getElementById("result").textContent = "Your password has been reset, you can log in now.";
+			return;
+		}
+		return response.text().then(function (text) {
+			document.getElementById("result").textContent = text;
+		});
+	});
+});
+</script>
+</body>
+</html>
+`))
+
+// ResetPasswordFormHandler serves the page the reset email links to, which
+// posts the new password to ResetPasswordHandler.
+func ResetPasswordFormHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "reset token is missing", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		// keep the token out of the Referer of anything the page loads
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.WriteHeader(http.StatusOK)
+		err := resetPasswordForm.Execute(w, struct {
+			Token     string
+			MinLength int
+		}{Token: token, MinLength: MinPasswordLength})
+		if err != nil {
+			log.Printf("error rendering reset form %v", err)
+		}
+	}
+}
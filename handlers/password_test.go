@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"go-rest-websockets/mailer"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// accountRepository knows a single account, john@doe.com.
+type accountRepository struct {
+	repository.Repository
+	repository.UserTokenRepository
+	repository.AuthEventRepository
+}
+
+func (r *accountRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if email != "john@doe.com" {
+		return &models.User{}, nil
+	}
+	return &models.User{Id: "user", Email: email}, nil
+}
+
+func (r *accountRepository) InvalidateUserTokens(ctx context.Context, userId string, purpose string) error {
+	return nil
+}
+
+func (r *accountRepository) InsertUserToken(ctx context.Context, token *models.UserToken) error {
+	return nil
+}
+
+func (r *accountRepository) InsertAuthEvent(ctx context.Context, event *models.AuthEvent) error {
+	return nil
+}
+
+// blockingMailer holds every mail until released, like a slow mail server.
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan mailer.Message
+}
+
+func (m *blockingMailer) Send(ctx context.Context, message mailer.Message) error {
+	<-m.release
+	m.sent <- message
+	return nil
+}
+
+func TestForgotPasswordHandlerDoesNotWaitForMail(t *testing.T) {
+	repo := &accountRepository{}
+	mail := &blockingMailer{release: make(chan struct{}), sent: make(chan mailer.Message, 1)}
+	throttle := server.NewLoginThrottle(map[string]server.ThrottleConfig{
+		server.ThrottleResetEmail: {FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, ForgetAfter: time.Hour},
+		server.ThrottleResetIP:    {FreeAttempts: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, ForgetAfter: time.Hour},
+	})
+	handler := ForgotPasswordHandler(testServer{config: &server.Config{PublicUrl: "http://localhost:5050"}}, repo, repo, mail, throttle, repo)
+
+	for _, email := range []string{"nobody@doe.com", "john@doe.com"} {
+		request := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+		recorder := httptest.NewRecorder()
+		// the mailer is still blocked, so answering proves the handler did not wait
+		handler(recorder, request)
+		if recorder.Code != http.StatusAccepted {
+			t.Errorf("%s: status is %d, want %d", email, recorder.Code, http.StatusAccepted)
+		}
+	}
+
+	close(mail.release)
+	select {
+	case message := <-mail.sent:
+		if message.To != "john@doe.com" || !strings.Contains(message.Body, "http://localhost:5050/password/reset?token=") {
+			t.Errorf("mail is %+v, want a reset link to john@doe.com", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reset mail was not sent")
+	}
+}
@@ -1,23 +1,77 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/gorilla/mux"
 	"github.com/segmentio/ksuid"
 	"go-rest-websockets/models"
+	"go-rest-websockets/notifications"
 	"go-rest-websockets/repository"
 	"go-rest-websockets/server"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 type UpsertPostRequest struct {
 	PostContent string `json:"postContent"`
 }
 
-func InsertPostHandler(s server.Server, repo repository.Repository, auth server.Authorization) http.HandlerFunc {
+func postAuthor(r *http.Request, repo repository.Repository, userId string) (*models.Author, error) {
+	user, err := repo.GetUserById(r.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+	return user.Author(), nil
+}
+
+// publishPost pushes a new post to the timelines of the author's followers and
+// to every other websocket session, skipping users who blocked or muted the
+// author, or the author of the shared original, or were blocked by them.
+func publishPost(ctx context.Context, s server.Server, follows repository.FollowRepository, blocks repository.BlockRepository, post *models.Post) {
+	hidden, err := blocks.GetUsersHiding(ctx, post.UserId)
+	if err != nil {
+		log.Printf("error loading users hiding %s %v", post.UserId, err)
+		return
+	}
+	// shares carry the original, which must not reach users hiding its author
+	if post.Original != nil && post.Original.UserId != post.UserId {
+		hidingOriginal, err := blocks.GetUsersHiding(ctx, post.Original.UserId)
+		if err != nil {
+			log.Printf("error loading users hiding %s %v", post.Original.UserId, err)
+			return
+		}
+		hidden = append(hidden, hidingOriginal...)
+	}
+	followers, err := follows.GetFollowerIds(ctx, post.UserId)
+	if err != nil {
+		// still broadcast, followers then only get Post_Created
+		log.Printf("error loading followers %v", err)
+		followers = nil
+	}
+	excluded := make(map[string]bool, len(hidden))
+	for _, userId := range hidden {
+		excluded[userId] = true
+	}
+	recipients := make([]string, 0, len(followers))
+	for _, userId := range followers {
+		if !excluded[userId] {
+			recipients = append(recipients, userId)
+		}
+	}
+	// followers get the post once, as a timeline post
+	s.Hub().BroadcastExcept(models.WebsocketMessage{
+		Type:    "Post_Created",
+		Payload: post,
+	}, append(hidden, followers...))
+	s.Hub().SendToUsers(recipients, models.WebsocketMessage{
+		Type:    "Timeline_Post",
+		Payload: post,
+	})
+}
+
+func InsertPostHandler(s server.Server, repo repository.Repository, follows repository.FollowRepository, blocks repository.BlockRepository, notifier *notifications.Notifier) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		insertPostRequest := UpsertPostRequest{}
 		err := json.NewDecoder(r.Body).Decode(&insertPostRequest)
@@ -26,10 +80,14 @@ func InsertPostHandler(s server.Server, repo repository.Repository, auth server.
 			return
 		}
 
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		claims, err := auth.ParseAndVerifyToken(s.Config().JWTSecret, tokenString)
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		author, err := postAuthor(r, repo, principal.UserId)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -42,7 +100,9 @@ func InsertPostHandler(s server.Server, repo repository.Repository, auth server.
 		post := models.Post{
 			Id:          id.String(),
 			PostContent: insertPostRequest.PostContent,
-			UserId:      claims.UserId,
+			UserId:      principal.UserId,
+			Author:      author,
+			PostType:    models.PostTypePost,
 		}
 
 		err = repo.InsertPost(r.Context(), &post)
@@ -50,11 +110,8 @@ func InsertPostHandler(s server.Server, repo repository.Repository, auth server.
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		message := models.WebsocketMessage{
-			Type:    "Post_Created",
-			Payload: post,
-		}
-		s.Hub().Broadcast(message, nil)
+		publishPost(r.Context(), s, follows, blocks, &post)
+		notifier.NotifyMentions(r.Context(), principal.UserId, post.Id, post.PostContent)
 
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(post)
@@ -64,7 +121,17 @@ func InsertPostHandler(s server.Server, repo repository.Repository, auth server.
 	}
 }
 
-func GetPostHandler(s server.Server, repository repository.Repository) http.HandlerFunc {
+// hiddenByBlock reports whether a block stands between the caller, if any,
+// and the author of some content.
+func hiddenByBlock(r *http.Request, blocks repository.BlockRepository, authorId string) (bool, error) {
+	principal, ok := server.PrincipalFromContext(r.Context())
+	if !ok || principal.UserId == authorId {
+		return false, nil
+	}
+	return blocks.IsBlocked(r.Context(), principal.UserId, authorId)
+}
+
+func GetPostHandler(s server.Server, repository repository.Repository, blocks repository.BlockRepository, reactions repository.ReactionRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		post, err := repository.GetPostById(r.Context(), params["id"])
@@ -76,6 +143,20 @@ func GetPostHandler(s server.Server, repository repository.Repository) http.Hand
 			http.Error(w, "post not found", http.StatusNotFound)
 			return
 		}
+		hidden, err := hiddenByBlock(r, blocks, post.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hidden {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		err = presentPosts(r, reactions, blocks, post)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(post)
@@ -85,7 +166,7 @@ func GetPostHandler(s server.Server, repository repository.Repository) http.Hand
 	}
 }
 
-func UpdatePostHandler(s server.Server, repository repository.Repository, auth server.Authorization) http.HandlerFunc {
+func UpdatePostHandler(s server.Server, repository repository.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		postId := params["id"]
@@ -95,22 +176,40 @@ func UpdatePostHandler(s server.Server, repository repository.Repository, auth s
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		claims, err := auth.ParseAndVerifyToken(s.Config().JWTSecret, tokenString)
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		author, err := postAuthor(r, repository, principal.UserId)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		post := models.Post{
 			Id:          postId,
 			PostContent: updatePostRequest.PostContent,
-			UserId:      claims.UserId,
+			UserId:      principal.UserId,
+			Author:      author,
 		}
-		err = repository.UpdatePost(r.Context(), &post)
+		updated, err := repository.UpdatePost(r.Context(), &post)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if !updated {
+			existing, err := repository.GetPostById(r.Context(), postId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if existing.UserId == principal.UserId && existing.PostType == models.PostTypeRepost {
+				http.Error(w, "reposts cannot be edited", http.StatusConflict)
+				return
+			}
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(post)
@@ -120,25 +219,30 @@ func UpdatePostHandler(s server.Server, repository repository.Repository, auth s
 	}
 }
 
-func DeletePostHandler(s server.Server, repository repository.Repository, auth server.Authorization) http.HandlerFunc {
+func DeletePostHandler(s server.Server, repository repository.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		postId := params["id"]
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		claims, err := auth.ParseAndVerifyToken(s.Config().JWTSecret, tokenString)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		post := models.Post{
-			Id:     postId,
-			UserId: claims.UserId,
+		var deleted bool
+		var err error
+		if principal.Can(server.PermissionPostsDeleteAny) {
+			deleted, err = repository.DeleteAnyPost(r.Context(), postId)
+		} else {
+			deleted, err = repository.DeletePost(r.Context(), &models.Post{Id: postId, UserId: principal.UserId})
 		}
-		err = repository.DeletePost(r.Context(), &post)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if !deleted {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
@@ -157,14 +261,23 @@ func getIntQueryParam(r *http.Request, key string, defaultVal int) (int, error)
 	return val, err
 }
 
-func GetPaginatedPostsHandler(s server.Server, repository repository.Repository) http.HandlerFunc {
+func GetPaginatedPostsHandler(s server.Server, repository repository.Repository, reactions repository.ReactionRepository, blocks repository.BlockRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		page, err := getIntQueryParam(r, "page", 0)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		posts, err := repository.GetPaginatedPosts(r.Context(), 10, page)
+		viewerId := ""
+		if principal, ok := server.PrincipalFromContext(r.Context()); ok {
+			viewerId = principal.UserId
+		}
+		posts, err := repository.GetPaginatedPosts(r.Context(), viewerId, 10, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = presentPostList(r, reactions, blocks, posts)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
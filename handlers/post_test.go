@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postRepository stubs the repository methods UpdatePostHandler and
+// DeletePostHandler use, any other call panics on the nil embedded interface.
+type postRepository struct {
+	repository.Repository
+	posts map[string]*models.Post
+}
+
+func (r *postRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	return &models.User{Id: id}, nil
+}
+
+func (r *postRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
+	post, ok := r.posts[id]
+	if !ok {
+		return &models.Post{}, nil
+	}
+	return post, nil
+}
+
+func (r *postRepository) UpdatePost(ctx context.Context, post *models.Post) (bool, error) {
+	stored, ok := r.posts[post.Id]
+	if !ok || stored.UserId != post.UserId || stored.PostType == models.PostTypeRepost {
+		return false, nil
+	}
+	stored.PostContent = post.PostContent
+	return true, nil
+}
+
+func (r *postRepository) DeletePost(ctx context.Context, post *models.Post) (bool, error) {
+	stored, ok := r.posts[post.Id]
+	if !ok || stored.UserId != post.UserId {
+		return false, nil
+	}
+	delete(r.posts, post.Id)
+	return true, nil
+}
+
+func (r *postRepository) DeleteAnyPost(ctx context.Context, id string) (bool, error) {
+	_, ok := r.posts[id]
+	delete(r.posts, id)
+	return ok, nil
+}
+
+func updatePost(repo *postRepository, principal *server.Principal, postId string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPut, "/posts/"+postId, strings.NewReader(`{"postContent":"edited"}`))
+	request = mux.SetURLVars(request, map[string]string{"id": postId})
+	if principal != nil {
+		request = request.WithContext(server.WithPrincipal(request.Context(), principal))
+	}
+	recorder := httptest.NewRecorder()
+	UpdatePostHandler(nil, repo)(recorder, request)
+	return recorder
+}
+
+func TestUpdatePostHandler(t *testing.T) {
+	repo := &postRepository{posts: map[string]*models.Post{
+		"post":   {Id: "post", UserId: "author", PostType: models.PostTypePost, PostContent: "original"},
+		"repost": {Id: "repost", UserId: "author", PostType: models.PostTypeRepost},
+	}}
+	author := &server.Principal{UserId: "author", TokenId: "token"}
+	other := &server.Principal{UserId: "other", TokenId: "token"}
+
+	cases := []struct {
+		name      string
+		principal *server.Principal
+		postId    string
+		status    int
+	}{
+		{"without principal", nil, "post", http.StatusUnauthorized},
+		{"own post", author, "post", http.StatusOK},
+		{"post of someone else", other, "post", http.StatusNotFound},
+		{"missing post", author, "missing", http.StatusNotFound},
+		{"own repost", author, "repost", http.StatusConflict},
+		{"repost of someone else", other, "repost", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		recorder := updatePost(repo, c.principal, c.postId)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+	if content := repo.posts["post"].PostContent; content != "edited" {
+		t.Errorf("post content is %q, want the edit", content)
+	}
+}
+
+func TestDeletePostHandler(t *testing.T) {
+	repo := &postRepository{posts: map[string]*models.Post{
+		"post":  {Id: "post", UserId: "author"},
+		"other": {Id: "other", UserId: "other"},
+	}}
+	author := &server.Principal{UserId: "author", TokenId: "token"}
+	moderator := &server.Principal{UserId: "moderator", Roles: []string{server.RoleModerator}, TokenId: "token"}
+
+	cases := []struct {
+		name      string
+		principal *server.Principal
+		postId    string
+		status    int
+	}{
+		{"without principal", nil, "post", http.StatusUnauthorized},
+		{"post of someone else", author, "other", http.StatusNotFound},
+		{"own post", author, "post", http.StatusOK},
+		{"deleted post", author, "post", http.StatusNotFound},
+		{"moderator", moderator, "other", http.StatusOK},
+		{"moderator on a missing post", moderator, "missing", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodDelete, "/posts/"+c.postId, nil)
+		request = mux.SetURLVars(request, map[string]string{"id": c.postId})
+		if c.principal != nil {
+			request = request.WithContext(server.WithPrincipal(request.Context(), c.principal))
+		}
+		recorder := httptest.NewRecorder()
+		DeletePostHandler(nil, repo)(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 500
+	MaxAvatarUrlLength   = 512
+)
+
+var handlePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,30}$`)
+
+// UpdateProfileRequest only changes the fields that are present.
+type UpdateProfileRequest struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"displayName"`
+	Bio         *string `json:"bio"`
+	AvatarUrl   *string `json:"avatarUrl"`
+}
+
+func validateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return fmt.Errorf("handle must have 3 to 30 letters, digits or underscores")
+	}
+	return nil
+}
+
+func validateAvatarUrl(avatarUrl string) error {
+	if avatarUrl == "" {
+		return nil
+	}
+	if len(avatarUrl) > MaxAvatarUrlLength {
+		return fmt.Errorf("avatar url must have at most %d characters", MaxAvatarUrlLength)
+	}
+	parsed, err := url.Parse(avatarUrl)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("avatar url must be an absolute http or https url")
+	}
+	return nil
+}
+
+func (p UpdateProfileRequest) apply(user *models.User) error {
+	if p.Handle != nil {
+		handle := strings.TrimSpace(*p.Handle)
+		err := validateHandle(handle)
+		if err != nil {
+			return err
+		}
+		user.Handle = handle
+	}
+	if p.DisplayName != nil {
+		displayName := strings.TrimSpace(*p.DisplayName)
+		if utf8.RuneCountInString(displayName) > MaxDisplayNameLength {
+			return fmt.Errorf("display name must have at most %d characters", MaxDisplayNameLength)
+		}
+		user.DisplayName = displayName
+	}
+	if p.Bio != nil {
+		bio := strings.TrimSpace(*p.Bio)
+		if utf8.RuneCountInString(bio) > MaxBioLength {
+			return fmt.Errorf("bio must have at most %d characters", MaxBioLength)
+		}
+		user.Bio = bio
+	}
+	if p.AvatarUrl != nil {
+		avatarUrl := strings.TrimSpace(*p.AvatarUrl)
+		err := validateAvatarUrl(avatarUrl)
+		if err != nil {
+			return err
+		}
+		user.AvatarUrl = avatarUrl
+	}
+	return nil
+}
+
+func UpdateProfileHandler(s server.Server, repo repository.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		updateRequest := UpdateProfileRequest{}
+		err := json.NewDecoder(r.Body).Decode(&updateRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, ok := currentUser(w, r, repo)
+		if !ok {
+			return
+		}
+		err = updateRequest.apply(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = repo.UpdateUserProfile(r.Context(), user)
+		if errors.Is(err, repository.ErrHandleTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(user.Profile())
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func GetProfileHandler(s server.Server, repo repository.Repository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := repo.GetUserByHandle(r.Context(), mux.Vars(r)["handle"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		hidden, err := hiddenByBlock(r, blocks, user.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hidden {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(user.Profile())
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// profileRepository holds the profile of "user", the handle "taken" belongs
+// to someone else.
+type profileRepository struct {
+	repository.Repository
+	user models.User
+}
+
+func (r *profileRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	user := r.user
+	return &user, nil
+}
+
+func (r *profileRepository) UpdateUserProfile(ctx context.Context, user *models.User) error {
+	if user.Handle == "taken" {
+		return repository.ErrHandleTaken
+	}
+	r.user = *user
+	return nil
+}
+
+func TestUpdateProfileHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"short handle", `{"handle":"jo"}`, http.StatusBadRequest},
+		{"handle with spaces", `{"handle":"john doe"}`, http.StatusBadRequest},
+		{"taken handle", `{"handle":"taken"}`, http.StatusConflict},
+		{"long display name", `{"displayName":"` + strings.Repeat("a", MaxDisplayNameLength+1) + `"}`, http.StatusBadRequest},
+		// the limits count characters, not the bytes they take
+		{"multibyte display name", `{"displayName":"` + strings.Repeat("é", MaxDisplayNameLength) + `"}`, http.StatusOK},
+		{"long bio", `{"bio":"` + strings.Repeat("a", MaxBioLength+1) + `"}`, http.StatusBadRequest},
+		{"relative avatar", `{"avatarUrl":"/avatar.png"}`, http.StatusBadRequest},
+		{"script avatar", `{"avatarUrl":"javascript:alert(1)"}`, http.StatusBadRequest},
+		{"avatar", `{"avatarUrl":"https://cdn.example/avatar.png"}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		repo := &profileRepository{user: models.User{Id: "user", Handle: "john", Bio: "bio"}}
+		request := httptest.NewRequest(http.MethodPatch, "/me/profile", strings.NewReader(c.body))
+		request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+		recorder := httptest.NewRecorder()
+		UpdateProfileHandler(nil, repo)(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+		// fields left out of the request are kept
+		if repo.user.Bio != "bio" {
+			t.Errorf("%s: bio is %q, want it kept", c.name, repo.user.Bio)
+		}
+	}
+}
+
+func TestUpdateProfileHandlerTrimsHandle(t *testing.T) {
+	repo := &profileRepository{user: models.User{Id: "user", Handle: "john"}}
+	request := httptest.NewRequest(http.MethodPatch, "/me/profile", strings.NewReader(`{"handle":" john_doe "}`))
+	request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+	UpdateProfileHandler(nil, repo)(httptest.NewRecorder(), request)
+	if repo.user.Handle != "john_doe" {
+		t.Errorf("handle is %q, want john_doe", repo.user.Handle)
+	}
+}
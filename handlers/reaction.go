@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/notifications"
+	"go-rest-websockets/reactions"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+// attachReactions fills in the reaction summaries of the posts as seen by the
+// caller, if any.
+func attachReactions(r *http.Request, repo repository.ReactionRepository, posts ...*models.Post) error {
+	viewerId := ""
+	if principal, ok := server.PrincipalFromContext(r.Context()); ok {
+		viewerId = principal.UserId
+	}
+	postIds := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+	summaries, err := repo.GetReactionSummaries(r.Context(), viewerId, postIds)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.Reactions = summaries[post.Id]
+	}
+	return nil
+}
+
+func writeReactions(w http.ResponseWriter, r *http.Request, repo repository.ReactionRepository, postId string) {
+	post := &models.Post{Id: postId}
+	err := attachReactions(r, repo, post)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(post.Reactions)
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+func reactionFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	reaction := mux.Vars(r)["reaction"]
+	if !models.IsKnownReaction(reaction) {
+		http.Error(w, "unknown reaction", http.StatusBadRequest)
+		return "", false
+	}
+	return reaction, true
+}
+
+func GetReactionsHandler(s server.Server, repo repository.Repository, reactions repository.ReactionRepository, blocks repository.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		post, ok := postFromPath(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		writeReactions(w, r, reactions, post.Id)
+	}
+}
+
+// ReactHandler adds a reaction of the caller to a post. Reacting twice with
+// the same reaction changes nothing.
+func ReactHandler(s server.Server, repo repository.Repository, reactions repository.ReactionRepository, blocks repository.BlockRepository, publisher *reactions.Publisher, notifier *notifications.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		reaction, ok := reactionFromPath(w, r)
+		if !ok {
+			return
+		}
+		post, ok := postFromPath(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		added, err := reactions.AddReaction(r.Context(), post.Id, principal.UserId, reaction)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if added {
+			publisher.Changed(post.Id)
+			notifier.Notify(r.Context(), post.UserId, principal.UserId, models.NotificationReaction, post.Id)
+		}
+		writeReactions(w, r, reactions, post.Id)
+	}
+}
+
+func UnreactHandler(s server.Server, repo repository.Repository, reactions repository.ReactionRepository, blocks repository.BlockRepository, publisher *reactions.Publisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		reaction, ok := reactionFromPath(w, r)
+		if !ok {
+			return
+		}
+		post, ok := postFromPath(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		err := reactions.RemoveReaction(r.Context(), post.Id, principal.UserId, reaction)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		publisher.Changed(post.Id)
+		writeReactions(w, r, reactions, post.Id)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	"go-rest-websockets/notifications"
+	"go-rest-websockets/reactions"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// reactionRepository holds the reactions to the post of "author", whom
+// "blocked" cannot see, and the notifications sent.
+type reactionRepository struct {
+	repository.Repository
+	repository.BlockRepository
+	repository.NotificationRepository
+	repository.ReactionRepository
+	reactions     map[string]map[string]bool
+	notifications int
+}
+
+func newReactionRepository() *reactionRepository {
+	return &reactionRepository{reactions: map[string]map[string]bool{}}
+}
+
+func (r *reactionRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
+	if id != "post" {
+		return &models.Post{}, nil
+	}
+	return &models.Post{Id: id, UserId: "author"}, nil
+}
+
+func (r *reactionRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	return &models.User{Id: id}, nil
+}
+
+func (r *reactionRepository) IsBlocked(ctx context.Context, userId string, otherUserId string) (bool, error) {
+	return userId == "blocked", nil
+}
+
+func (r *reactionRepository) IsHiddenFrom(ctx context.Context, viewerId string, authorId string) (bool, error) {
+	return false, nil
+}
+
+func (r *reactionRepository) InsertNotification(ctx context.Context, notification *models.Notification) error {
+	r.notifications++
+	return nil
+}
+
+func (r *reactionRepository) CountUnreadNotifications(ctx context.Context, userId string) (int, error) {
+	return r.notifications, nil
+}
+
+func (r *reactionRepository) AddReaction(ctx context.Context, postId string, userId string, reaction string) (bool, error) {
+	if r.reactions[reaction] == nil {
+		r.reactions[reaction] = map[string]bool{}
+	}
+	added := !r.reactions[reaction][userId]
+	r.reactions[reaction][userId] = true
+	return added, nil
+}
+
+func (r *reactionRepository) RemoveReaction(ctx context.Context, postId string, userId string, reaction string) error {
+	delete(r.reactions[reaction], userId)
+	return nil
+}
+
+func (r *reactionRepository) GetReactionSummaries(ctx context.Context, viewerId string, postIds []string) (map[string]*models.ReactionSummary, error) {
+	summary := models.NewReactionSummary()
+	for reaction, users := range r.reactions {
+		if len(users) > 0 {
+			summary.Counts[reaction] = len(users)
+		}
+		if users[viewerId] {
+			summary.Viewer = append(summary.Viewer, reaction)
+		}
+	}
+	return map[string]*models.ReactionSummary{"post": summary}, nil
+}
+
+func TestReactions(t *testing.T) {
+	repo := newReactionRepository()
+	hub := websockets.NewHub()
+	publisher := reactions.NewPublisher(repo, hub, time.Hour)
+	react := ReactHandler(nil, repo, repo, repo, publisher, notifications.NewNotifier(repo, hub))
+	unreact := UnreactHandler(nil, repo, repo, repo, publisher)
+	cases := []struct {
+		name     string
+		handler  http.HandlerFunc
+		userId   string
+		postId   string
+		reaction string
+		status   int
+		likes    int
+	}{
+		{"unknown reaction", react, "fan", "post", "dislike", http.StatusBadRequest, 0},
+		{"missing post", react, "fan", "missing", models.ReactionLike, http.StatusNotFound, 0},
+		{"blocked user", react, "blocked", "post", models.ReactionLike, http.StatusNotFound, 0},
+		{"like", react, "fan", "post", models.ReactionLike, http.StatusOK, 1},
+		// reacting twice with the same reaction changes nothing
+		{"like again", react, "fan", "post", models.ReactionLike, http.StatusOK, 1},
+		{"like of the author", react, "author", "post", models.ReactionLike, http.StatusOK, 2},
+		{"unlike", unreact, "fan", "post", models.ReactionLike, http.StatusOK, 1},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodPut, "/posts/"+c.postId+"/reactions/"+c.reaction, nil)
+		request = mux.SetURLVars(request, map[string]string{"id": c.postId, "reaction": c.reaction})
+		request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: c.userId, TokenId: "token"}))
+		recorder := httptest.NewRecorder()
+		c.handler(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+			continue
+		}
+		if likes := len(repo.reactions[models.ReactionLike]); likes != c.likes {
+			t.Errorf("%s: post has %d likes, want %d", c.name, likes, c.likes)
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		summary := models.ReactionSummary{}
+		err := json.NewDecoder(recorder.Body).Decode(&summary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Counts[models.ReactionLike] != c.likes {
+			t.Errorf("%s: answered %d likes, want %d", c.name, summary.Counts[models.ReactionLike], c.likes)
+		}
+	}
+	// only the first like of the fan notifies, the author is not told about their own
+	if repo.notifications != 1 {
+		t.Errorf("%d notifications sent, want 1", repo.notifications)
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/notifications"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// hideOriginals drops the originals embedded in shares when a block or mute
+// hides their author from the caller, marking them unavailable instead.
+func hideOriginals(r *http.Request, blocks repository.BlockRepository, posts ...*models.Post) error {
+	principal, ok := server.PrincipalFromContext(r.Context())
+	if !ok {
+		return nil
+	}
+	hiddenAuthors := map[string]bool{}
+	for _, post := range posts {
+		if post.Original == nil || post.Original.UserId == principal.UserId {
+			continue
+		}
+		authorId := post.Original.UserId
+		hidden, checked := hiddenAuthors[authorId]
+		if !checked {
+			var err error
+			hidden, err = blocks.IsHiddenFrom(r.Context(), principal.UserId, authorId)
+			if err != nil {
+				return err
+			}
+			hiddenAuthors[authorId] = hidden
+		}
+		if hidden {
+			post.Original = nil
+			post.OriginalUnavailable = true
+		}
+	}
+	return nil
+}
+
+// presentPosts prepares posts for the caller: originals they may not see are
+// hidden and their reactions are filled in.
+func presentPosts(r *http.Request, reactions repository.ReactionRepository, blocks repository.BlockRepository, posts ...*models.Post) error {
+	err := hideOriginals(r, blocks, posts...)
+	if err != nil {
+		return err
+	}
+	return attachReactions(r, reactions, posts...)
+}
+
+func presentPostList(r *http.Request, reactions repository.ReactionRepository, blocks repository.BlockRepository, posts []models.Post) error {
+	pointers := make([]*models.Post, 0, len(posts))
+	for i := range posts {
+		pointers = append(pointers, &posts[i])
+	}
+	return presentPosts(r, reactions, blocks, pointers...)
+}
+
+// shareTarget loads the post named in the path as the original to share.
+// Sharing a repost shares the post it reposts.
+func shareTarget(w http.ResponseWriter, r *http.Request, repo repository.Repository, blocks repository.BlockRepository) (*models.Post, bool) {
+	post, ok := postFromPath(w, r, repo, blocks)
+	if !ok {
+		return nil, false
+	}
+	if post.PostType != models.PostTypeRepost {
+		return post, true
+	}
+	if post.Original == nil {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return nil, false
+	}
+	hidden, err := hiddenByBlock(r, blocks, post.Original.UserId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if hidden {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return nil, false
+	}
+	return post.Original, true
+}
+
+// insertShare stores a repost or quote of original and answers with it, its
+// original embedded, after pushing it to websocket sessions and followers.
+func insertShare(w http.ResponseWriter, r *http.Request, s server.Server, repo repository.Repository, follows repository.FollowRepository, blocks repository.BlockRepository, reactions repository.ReactionRepository, share *models.Post) bool {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	share.Id = id.String()
+	err = repo.InsertPost(r.Context(), share)
+	if errors.Is(err, repository.ErrAlreadyReposted) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	post, err := repo.GetPostById(r.Context(), share.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	publishPost(r.Context(), s, follows, blocks, post)
+	writePresentedPost(w, r, reactions, blocks, http.StatusCreated, post)
+	return true
+}
+
+func writePresentedPost(w http.ResponseWriter, r *http.Request, reactions repository.ReactionRepository, blocks repository.BlockRepository, status int, post *models.Post) {
+	err := presentPosts(r, reactions, blocks, post)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(post)
+	if err != nil {
+		log.Printf("error encoding response %v", err)
+	}
+}
+
+// RepostHandler reposts a post. Reposting it again answers with the existing
+// repost.
+func RepostHandler(s server.Server, repo repository.Repository, follows repository.FollowRepository, blocks repository.BlockRepository, reactions repository.ReactionRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		original, ok := shareTarget(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		existing, err := repo.GetRepost(r.Context(), principal.UserId, original.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing.Id != "" {
+			writePresentedPost(w, r, reactions, blocks, http.StatusOK, existing)
+			return
+		}
+		insertShare(w, r, s, repo, follows, blocks, reactions, &models.Post{
+			UserId:         principal.UserId,
+			PostType:       models.PostTypeRepost,
+			OriginalPostId: original.Id,
+		})
+	}
+}
+
+func UndoRepostHandler(s server.Server, repo repository.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := repo.DeleteRepost(r.Context(), principal.UserId, mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func QuotePostHandler(s server.Server, repo repository.Repository, follows repository.FollowRepository, blocks repository.BlockRepository, reactions repository.ReactionRepository, notifier *notifications.Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		quoteRequest := UpsertPostRequest{}
+		err := json.NewDecoder(r.Body).Decode(&quoteRequest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(quoteRequest.PostContent) == "" {
+			http.Error(w, "postContent is required", http.StatusBadRequest)
+			return
+		}
+		original, ok := shareTarget(w, r, repo, blocks)
+		if !ok {
+			return
+		}
+		quote := models.Post{
+			PostContent:    quoteRequest.PostContent,
+			UserId:         principal.UserId,
+			PostType:       models.PostTypeQuote,
+			OriginalPostId: original.Id,
+		}
+		if insertShare(w, r, s, repo, follows, blocks, reactions, &quote) {
+			notifier.NotifyMentions(r.Context(), principal.UserId, quote.Id, quote.PostContent)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		value  string
+		length int
+		want   string
+	}{
+		{"Mozilla", 512, "Mozilla"},
+		{"Mozilla", 3, "Moz"},
+		// "é" takes two bytes and must not be split
+		{"abé", 3, "ab"},
+		{"abé", 4, "abé"},
+		{"ab\xffcd", 4, "abcd"},
+		{strings.Repeat("ü", 300), 512, strings.Repeat("ü", 256)},
+	}
+	for _, c := range cases {
+		got := truncate(c.value, c.length)
+		if got != c.want {
+			t.Errorf("truncate(%q, %d) is %q, want %q", c.value, c.length, got, c.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) is invalid UTF-8", c.value, c.length)
+		}
+	}
+}
@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/segmentio/ksuid"
+	"go-rest-websockets/mailer"
 	"go-rest-websockets/models"
 	"go-rest-websockets/repository"
 	"go-rest-websockets/server"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"net/mail"
 	"strings"
 )
 
@@ -20,21 +23,35 @@ type SignUpLoginRequest struct {
 }
 
 type SignUpResponse struct {
-	Id    string `json:"id"`
-	Email string `json:"email"`
+	Id            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
 }
 
 type MeResponse struct {
-	Email string `json:"email"`
-	Id    string `json:"id"`
+	models.Profile
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"emailVerified"`
+	Roles         []string `json:"roles"`
 }
 
 type LoginResponse struct {
-	UserId string `json:"userId"`
-	Token  string `json:"token"`
+	UserId      string `json:"userId"`
+	Token       string `json:"token,omitempty"`
+	MFARequired bool   `json:"mfaRequired,omitempty"`
+	MFAToken    string `json:"mfaToken,omitempty"`
+	CSRFToken   string `json:"csrfToken,omitempty"`
 }
 
-func SignUpHandler(s server.Server, r repository.Repository) http.HandlerFunc {
+func validateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return fmt.Errorf("invalid email address")
+	}
+	return nil
+}
+
+func SignUpHandler(s server.Server, r repository.Repository, tokens repository.UserTokenRepository, mail mailer.Mailer) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		signUpRequest := SignUpLoginRequest{}
 		err := json.NewDecoder(request.Body).Decode(&signUpRequest)
@@ -44,6 +61,13 @@ func SignUpHandler(s server.Server, r repository.Repository) http.HandlerFunc {
 			return
 		}
 
+		signUpRequest.Email = strings.TrimSpace(signUpRequest.Email)
+		err = validateEmail(signUpRequest.Email)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		id, err := ksuid.NewRandom()
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
@@ -52,6 +76,7 @@ func SignUpHandler(s server.Server, r repository.Repository) http.HandlerFunc {
 		hashed, err := bcrypt.GenerateFromPassword([]byte(signUpRequest.Password), HashCost)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
 		}
 		signUpUser := models.User{
 			Id:       id.String(),
@@ -64,6 +89,11 @@ func SignUpHandler(s server.Server, r repository.Repository) http.HandlerFunc {
 			return
 		}
 
+		err = sendEmailVerification(request.Context(), s, tokens, mail, &signUpUser)
+		if err != nil {
+			log.Printf("error sending email verification %v", err)
+		}
+
 		writer.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(writer).Encode(SignUpResponse{
 			Id:    id.String(),
@@ -75,7 +105,11 @@ func SignUpHandler(s server.Server, r repository.Repository) http.HandlerFunc {
 	}
 }
 
-func LoginHandler(s server.Server, r repository.Repository, auth server.Authorization) http.HandlerFunc {
+// dummyPasswordHash is compared against when the email is unknown so the
+// response takes as long as for an existing account.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), HashCost)
+
+func LoginHandler(s server.Server, r repository.Repository, auth server.Authorization, throttle *server.LoginThrottle, events repository.AuthEventRepository) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		loginRequest := SignUpLoginRequest{}
 		err := json.NewDecoder(request.Body).Decode(&loginRequest)
@@ -85,60 +119,136 @@ func LoginHandler(s server.Server, r repository.Repository, auth server.Authoriz
 			return
 		}
 
+		accountKey := server.ThrottleKey(server.ThrottleAccount, loginRequest.Email)
+		ipKey := server.ThrottleKey(server.ThrottleIP, clientIP(request))
+		if wait := throttle.Check(accountKey, ipKey); wait > 0 {
+			recordAuthEvent(request.Context(), events, request, models.AuthEventLoginThrottled, "", loginRequest.Email)
+			tooManyAttempts(writer, wait)
+			return
+		}
+
 		user, err := r.GetUserByEmail(request.Context(), loginRequest.Email)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if user == nil {
-			http.Error(writer, "invalid credentials", http.StatusUnauthorized)
-			return
+		passwordHash := []byte(user.Password)
+		if user.Id == "" {
+			passwordHash = dummyPasswordHash
 		}
-
-		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password))
-		if user == nil {
+		err = bcrypt.CompareHashAndPassword(passwordHash, []byte(loginRequest.Password))
+		if err != nil || user.Id == "" {
+			recordAuthEvent(request.Context(), events, request, models.AuthEventLoginFailed, user.Id, loginRequest.Email)
 			http.Error(writer, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
+		throttle.Success(accountKey)
+		throttle.Release(ipKey)
+		completeLogin(writer, request, s, r, auth, events, user, wantsSessionCookie(s, request))
+	}
+}
 
-		tokenString, err := auth.SignToken(s.Config().JWTSecret, user.Id)
+// wantsSessionCookie reports whether a browser client asked, with the
+// session=cookie query parameter, to receive the token as a cookie.
+func wantsSessionCookie(s server.Server, request *http.Request) bool {
+	return s.Config().SessionCookies.Enabled && request.URL.Query().Get("session") == "cookie"
+}
+
+// completeLogin asks for the second factor when the user enrolled one and
+// otherwise issues the session token.
+func completeLogin(writer http.ResponseWriter, request *http.Request, s server.Server, r repository.Repository, auth server.Authorization, events repository.AuthEventRepository, user *models.User, cookie bool) {
+	if user.TotpEnabled {
+		challenge, err := auth.SignMFAChallenge(user.Id)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		recordAuthEvent(request.Context(), events, request, models.AuthEventMFAChallenged, user.Id, user.Email)
+		writeLoginResponse(writer, LoginResponse{
+			UserId:      user.Id,
+			MFARequired: true,
+			MFAToken:    challenge,
+		})
+		return
+	}
 
-		loginResponse := LoginResponse{
-			UserId: user.Id,
-			Token:  tokenString,
-		}
+	recordAuthEvent(request.Context(), events, request, models.AuthEventLoginSucceeded, user.Id, user.Email)
+	issueLoginToken(writer, request, s, r, auth, user, cookie)
+}
 
-		writer.WriteHeader(http.StatusOK)
-		writer.Header().Set("Content-Type", "application/json")
-		err = json.NewEncoder(writer).Encode(loginResponse)
+// issueLoginToken returns the session token in the body, or as a cookie with
+// only the csrf token in the body when cookie is set.
+func issueLoginToken(writer http.ResponseWriter, request *http.Request, s server.Server, r repository.Repository, auth server.Authorization, user *models.User, cookie bool) {
+	var err error
+	user.Roles, err = r.GetUserRoles(request.Context(), user.Id)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tokenString, err := auth.StartSession(request.Context(), user, &models.Session{
+		Device:    describeDevice(request.UserAgent()),
+		UserAgent: truncate(request.UserAgent(), 512),
+		Ip:        clientIP(request),
+	})
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if cookie {
+		csrfToken, err := server.SetSessionCookies(writer, s.Config().SessionCookies, tokenString)
 		if err != nil {
-			log.Printf("error while encoding %v", err)
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		writeLoginResponse(writer, LoginResponse{
+			UserId:    user.Id,
+			CSRFToken: csrfToken,
+		})
+		return
+	}
+
+	writeLoginResponse(writer, LoginResponse{
+		UserId: user.Id,
+		Token:  tokenString,
+	})
+}
+
+func writeLoginResponse(writer http.ResponseWriter, loginResponse LoginResponse) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(writer).Encode(loginResponse)
+	if err != nil {
+		log.Printf("error while encoding %v", err)
 	}
 }
 
-func MeHandler(s server.Server, repository repository.Repository, auth server.Authorization) http.HandlerFunc {
+func MeHandler(s server.Server, repository repository.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-		claims, err := auth.ParseAndVerifyToken(s.Config().JWTSecret, tokenString)
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := repository.GetUserById(r.Context(), principal.UserId)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		user, err := repository.GetUserById(r.Context(), claims.UserId)
+
+		roles, err := repository.GetUserRoles(r.Context(), user.Id)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		response := MeResponse{
-			Email: user.Email,
-			Id:    user.Id,
+			Profile:       user.Profile(),
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			Roles:         roles,
 		}
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
@@ -146,3 +256,41 @@ func MeHandler(s server.Server, repository repository.Repository, auth server.Au
 		}
 	}
 }
+
+func LogoutHandler(s server.Server, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := auth.RevokeToken(r.Context(), principal)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if s.Config().SessionCookies.Enabled {
+			server.ClearSessionCookies(w, s.Config().SessionCookies)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func LogoutAllHandler(s server.Server, auth server.Authorization) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		err := auth.RevokeUserTokens(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if s.Config().SessionCookies.Enabled {
+			server.ClearSessionCookies(w, s.Config().SessionCookies)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
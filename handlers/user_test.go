@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// loginRepository records the sessions started.
+type loginRepository struct {
+	repository.Repository
+	repository.SessionRepository
+	sessions []models.Session
+}
+
+func (r *loginRepository) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (r *loginRepository) InsertSession(ctx context.Context, session *models.Session) error {
+	r.sessions = append(r.sessions, *session)
+	return nil
+}
+
+func TestIssueLoginTokenInCookie(t *testing.T) {
+	repo := &loginRepository{}
+	keys, err := server.LoadKeySet(t.TempDir(), server.AlgorithmEdDSA, 3*time.Hour, 2*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := server.NewAuthorization(keys, server.NewRevocationStore(nil, websockets.NewHub()), nil, repo)
+	s := testServer{config: &server.Config{SessionCookies: server.SessionCookieConfig{Enabled: true}}}
+
+	for _, cookie := range []bool{false, true} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/login?session=cookie", nil)
+		issueLoginToken(recorder, request, s, repo, auth, &models.User{Id: "user"}, cookie)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("cookie %v: status is %d, want %d", cookie, recorder.Code, http.StatusOK)
+		}
+		response := LoginResponse{}
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookies := map[string]*http.Cookie{}
+		for _, set := range recorder.Result().Cookies() {
+			cookies[set.Name] = set
+		}
+		if !cookie {
+			if response.Token == "" || len(cookies) != 0 {
+				t.Errorf("token login answered token %q and cookies %v", response.Token, cookies)
+			}
+			continue
+		}
+
+		// scripts must not be able to read the session token
+		if response.Token != "" {
+			t.Error("cookie login put the token in the body")
+		}
+		session, csrf := cookies[server.SessionCookieName], cookies[server.CSRFCookieName]
+		if session == nil || csrf == nil {
+			t.Fatalf("cookies set are %v, want session and csrf", cookies)
+		}
+		if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+			t.Errorf("session cookie is %+v", session)
+		}
+		if csrf.HttpOnly || csrf.Value != response.CSRFToken {
+			t.Errorf("csrf cookie is %+v, want it readable and matching the body", csrf)
+		}
+		if _, err := auth.ParseAndVerifyToken(session.Value); err != nil {
+			t.Errorf("session cookie holds no valid token: %v", err)
+		}
+	}
+	if len(repo.sessions) != 2 {
+		t.Errorf("%d sessions started, want 2", len(repo.sessions))
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/mailer"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/url"
+	"time"
+)
+
+// issueUserToken replaces any pending token of the same purpose and returns
+// the secret to send to the user.
+func issueUserToken(ctx context.Context, tokens repository.UserTokenRepository, userId string, purpose string, data string, expires time.Duration) (string, error) {
+	err := tokens.InvalidateUserTokens(ctx, userId, purpose)
+	if err != nil {
+		return "", err
+	}
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	secret, secretHash, err := server.GenerateSecret("")
+	if err != nil {
+		return "", err
+	}
+	token := models.UserToken{
+		Id:        id.String(),
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: secretHash,
+		ExpiresAt: time.Now().Add(expires),
+		Data:      data,
+	}
+	err = tokens.InsertUserToken(ctx, &token)
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func userTokenLink(s server.Server, path string, secret string) string {
+	return fmt.Sprintf("%s%s?token=%s", s.Config().PublicUrl, path, url.QueryEscape(secret))
+}
+
+func sendEmailVerification(ctx context.Context, s server.Server, tokens repository.UserTokenRepository, mail mailer.Mailer, user *models.User) error {
+	secret, err := issueUserToken(ctx, tokens, user.Id, models.UserTokenEmailVerification, "", EmailVerificationExpires)
+	if err != nil {
+		return err
+	}
+	return mail.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Confirm this is your email address by opening the following link. It expires in %v.\n\n%s", EmailVerificationExpires, userTokenLink(s, "/verify", secret)),
+	})
+}
+
+// sendMailInBackground answers the request without waiting on the mail
+// server, so the response time does not tell whether a mail was sent.
+func sendMailInBackground(mail mailer.Mailer, message mailer.Message) {
+	go func() {
+		err := mail.Send(context.Background(), message)
+		if err != nil {
+			log.Printf("error sending email %q %v", message.Subject, err)
+		}
+	}()
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-rest-websockets/mailer"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net/http"
+)
+
+type VerifyEmailResponse struct {
+	UserId        string `json:"userId"`
+	EmailVerified bool   `json:"emailVerified"`
+}
+
+func VerifyEmailHandler(s server.Server, repo repository.Repository, tokens repository.UserTokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := r.URL.Query().Get("token")
+		token, err := tokens.ConsumeUserToken(r.Context(), models.UserTokenEmailVerification, server.HashSecret(secret))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if token.Id == "" {
+			http.Error(w, "verification token is invalid or has expired", http.StatusBadRequest)
+			return
+		}
+		err = repo.SetUserEmailVerified(r.Context(), token.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(VerifyEmailResponse{UserId: token.UserId, EmailVerified: true})
+		if err != nil {
+			log.Printf("error encoding response %v", err)
+		}
+	}
+}
+
+func ResendEmailVerificationHandler(s server.Server, repo repository.Repository, tokens repository.UserTokenRepository, mail mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, err := repo.GetUserById(r.Context(), principal.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.EmailVerified {
+			http.Error(w, "email address is already verified", http.StatusConflict)
+			return
+		}
+		err = sendEmailVerification(r.Context(), s, tokens, mail, user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
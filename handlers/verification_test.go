@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"go-rest-websockets/mailer"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenRepository keeps user tokens in memory and, like the database, hands
+// out each live token once.
+type tokenRepository struct {
+	repository.UserTokenRepository
+	tokens []*models.UserToken
+	used   map[string]bool
+}
+
+func newTokenRepository() *tokenRepository {
+	return &tokenRepository{used: map[string]bool{}}
+}
+
+func (r *tokenRepository) InsertUserToken(ctx context.Context, token *models.UserToken) error {
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *tokenRepository) ConsumeUserToken(ctx context.Context, purpose string, tokenHash string) (*models.UserToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.Purpose == purpose && !r.used[token.Id] && token.ExpiresAt.After(time.Now()) {
+			r.used[token.Id] = true
+			return token, nil
+		}
+	}
+	return &models.UserToken{}, nil
+}
+
+func (r *tokenRepository) InvalidateUserTokens(ctx context.Context, userId string, purpose string) error {
+	for _, token := range r.tokens {
+		if token.UserId == userId && token.Purpose == purpose {
+			r.used[token.Id] = true
+		}
+	}
+	return nil
+}
+
+// mailedToken reads the token of the link in the last mail sent.
+func mailedToken(t *testing.T, mail *mailer.MemoryMailer) string {
+	t.Helper()
+	messages := mail.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no mail sent")
+	}
+	body := messages[len(messages)-1].Body
+	link, err := url.Parse(strings.TrimSpace(body[strings.LastIndex(body, "\n"):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("token")
+}
+
+// verificationRepository holds a single account, verified or not.
+type verificationRepository struct {
+	repository.Repository
+	user models.User
+}
+
+func (r *verificationRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	user := r.user
+	return &user, nil
+}
+
+func (r *verificationRepository) SetUserEmailVerified(ctx context.Context, id string) error {
+	r.user.EmailVerified = true
+	return nil
+}
+
+func TestEmailVerification(t *testing.T) {
+	repo := &verificationRepository{user: models.User{Id: "user", Email: "john@doe.com"}}
+	tokens := newTokenRepository()
+	mail := mailer.NewMemoryMailer()
+	s := testServer{config: &server.Config{PublicUrl: "http://localhost:5050"}}
+
+	resend := func() int {
+		request := httptest.NewRequest(http.MethodPost, "/me/verification", nil)
+		request = request.WithContext(server.WithPrincipal(request.Context(), &server.Principal{UserId: "user", TokenId: "token"}))
+		recorder := httptest.NewRecorder()
+		ResendEmailVerificationHandler(s, repo, tokens, mail)(recorder, request)
+		return recorder.Code
+	}
+	verify := func(secret string) int {
+		request := httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(secret), nil)
+		recorder := httptest.NewRecorder()
+		VerifyEmailHandler(s, repo, tokens)(recorder, request)
+		return recorder.Code
+	}
+
+	if status := resend(); status != http.StatusAccepted {
+		t.Fatalf("resend status is %d, want %d", status, http.StatusAccepted)
+	}
+	first := mailedToken(t, mail)
+	if status := resend(); status != http.StatusAccepted {
+		t.Fatalf("second resend status is %d, want %d", status, http.StatusAccepted)
+	}
+	secret := mailedToken(t, mail)
+
+	if status := verify("invalid"); status != http.StatusBadRequest {
+		t.Errorf("invalid token status is %d, want %d", status, http.StatusBadRequest)
+	}
+	// resending replaces the link sent before
+	if status := verify(first); status != http.StatusBadRequest {
+		t.Errorf("replaced token status is %d, want %d", status, http.StatusBadRequest)
+	}
+	if repo.user.EmailVerified {
+		t.Fatal("email verified without the latest token")
+	}
+	if status := verify(secret); status != http.StatusOK {
+		t.Fatalf("verify status is %d, want %d", status, http.StatusOK)
+	}
+	if !repo.user.EmailVerified {
+		t.Fatal("email is not verified")
+	}
+	if status := verify(secret); status != http.StatusBadRequest {
+		t.Errorf("reused token status is %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := resend(); status != http.StatusConflict {
+		t.Errorf("resend once verified status is %d, want %d", status, http.StatusConflict)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"strings"
+)
+
+// WebSocketHandler accepts anonymous connections, and binds the connection to
+// the user and token when one is provided so it can be closed on revocation.
+// Browsers cannot set headers on websocket requests, so they pass the token as
+// a handshake protocol, see websockets.BearerProtocol, or use the session
+// cookie. Credentials that fail to authenticate are rejected rather than
+// downgraded to an anonymous connection.
+func WebSocketHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := server.PrincipalFromContext(r.Context())
+		// the route is public, so the middleware lets bad credentials through
+		if !ok && sentCredential(s, r) {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		if !ok {
+			s.Hub().HandleWebSocket(w, r)
+			return
+		}
+		// the connection would stream the user's messages and notifications,
+		// which impersonation may not read over REST either
+		if principal.IsImpersonated() {
+			http.Error(w, "impersonation cannot open websocket connections", http.StatusForbidden)
+			return
+		}
+		s.Hub().HandleAuthenticatedWebSocket(w, r, principal.UserId, principal.CredentialId())
+	}
+}
+
+func sentCredential(s server.Server, r *http.Request) bool {
+	if strings.TrimSpace(r.Header.Get("Authorization")) != "" {
+		return true
+	}
+	if _, ok := websockets.BearerToken(r); ok {
+		return true
+	}
+	if !s.Config().SessionCookies.Enabled {
+		return false
+	}
+	cookie, err := r.Cookie(server.SessionCookieName)
+	return err == nil && cookie.Value != ""
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebSocketHandlerRejectsCredentials(t *testing.T) {
+	impersonated := &server.Principal{UserId: "user", TokenId: "token", ActorId: "admin", ReadOnly: true}
+	cases := []struct {
+		name      string
+		principal *server.Principal
+		header    string
+		value     string
+		status    int
+	}{
+		{"invalid authorization header", nil, "Authorization", "Bearer invalid", http.StatusUnauthorized},
+		{"invalid protocol token", nil, "Sec-WebSocket-Protocol", "bearer, invalid", http.StatusUnauthorized},
+		{"invalid session cookie", nil, "Cookie", server.SessionCookieName + "=invalid", http.StatusUnauthorized},
+		{"impersonation", impersonated, "Sec-WebSocket-Protocol", "bearer, token", http.StatusForbidden},
+	}
+	s := testServer{config: &server.Config{SessionCookies: server.SessionCookieConfig{Enabled: true}}}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		request.Header.Set(c.header, c.value)
+		if c.principal != nil {
+			request = request.WithContext(server.WithPrincipal(request.Context(), c.principal))
+		}
+		recorder := httptest.NewRecorder()
+		WebSocketHandler(s)(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+}
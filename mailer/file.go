@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"os"
+	"path/filepath"
+)
+
+// FileMailer writes every message to its own file in dir instead of sending it.
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	data := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", message.To, message.Subject, message.Body)
+	return os.WriteFile(filepath.Join(m.dir, id.String()+".eml"), []byte(data), 0600)
+}
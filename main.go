@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
+	"go-rest-websockets/exports"
 	"go-rest-websockets/handlers"
+	"go-rest-websockets/mailer"
 	"go-rest-websockets/middlewares"
+	"go-rest-websockets/notifications"
+	"go-rest-websockets/reactions"
 	"go-rest-websockets/repository"
 	"go-rest-websockets/server"
 	"go-rest-websockets/websockets"
 	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
 func main() {
@@ -20,9 +26,28 @@ func main() {
 		log.Fatalf("cannot load configuration %v", err)
 	}
 	config := &server.Config{
-		Port:        os.Getenv("PORT"),
-		JWTSecret:   os.Getenv("JWT_SECRET"),
-		DatabaseUrl: os.Getenv("DATABASE_URL"),
+		Port:            os.Getenv("PORT"),
+		JWTKeysDir:      os.Getenv("JWT_KEYS_DIR"),
+		JWTAlgorithm:    getEnv("JWT_ALGORITHM", server.AlgorithmRS256),
+		JWTKeyRotation:  getDurationEnv("JWT_KEY_ROTATION", 24*time.Hour),
+		JWTKeyOverlap:   getDurationEnv("JWT_KEY_OVERLAP", 2*time.Hour),
+		JWTKeyRotator:   getEnv("JWT_KEY_ROTATOR", "true") == "true",
+		DatabaseUrl:     os.Getenv("DATABASE_URL"),
+		PublicUrl:       getEnv("PUBLIC_URL", "http://localhost"+os.Getenv("PORT")),
+		TOTPIssuer:      getEnv("TOTP_ISSUER", "go-rest-websockets"),
+		AccountDeletion: getEnv("ACCOUNT_DELETION", server.AccountDeletionAnonymize),
+		RequireVerifiedEmail: server.VerifiedEmailRestrictions{
+			ToPost: getEnv("REQUIRE_VERIFIED_EMAIL_TO_POST", "true") == "true",
+		},
+		SessionCookies: server.SessionCookieConfig{
+			Enabled:  getEnv("SESSION_COOKIES", "false") == "true",
+			Insecure: getEnv("SESSION_COOKIES_INSECURE", "false") == "true",
+		},
+		OIDC: server.OIDCConfig{
+			Issuer:       os.Getenv("OIDC_ISSUER"),
+			ClientId:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		},
 	}
 
 	hub := websockets.NewHub()
@@ -33,20 +58,182 @@ func main() {
 	}
 
 	repo, err := repository.NewPostgresUserRepository(os.Getenv("DATABASE_URL"))
-	authorization := server.NewAuthorization()
+	if err != nil {
+		log.Fatalf("cannot initialize repository %v", err)
+	}
+	err = server.BootstrapAdmin(context.Background(), repo, os.Getenv("BOOTSTRAP_ADMIN_EMAIL"))
+	if err != nil {
+		log.Printf("cannot bootstrap admin %v", err)
+	}
+	revocations := server.NewRevocationStore(repo, hub)
+	err = revocations.Load(context.Background())
+	if err != nil {
+		log.Fatalf("cannot load token revocations %v", err)
+	}
+	go revocations.Run(context.Background())
+	keys, err := server.LoadKeySet(config.JWTKeysDir, config.JWTAlgorithm, config.JWTKeyRotation, config.JWTKeyOverlap, config.JWTKeyRotator)
+	if err != nil {
+		log.Fatalf("cannot load signing keys %v", err)
+	}
+	go keys.RunRotation(context.Background())
+	authorization := server.NewAuthorization(keys, revocations, repo, repo)
+	throttle := server.NewLoginThrottle(map[string]server.ThrottleConfig{
+		server.ThrottleAccount:    {FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 15 * time.Minute, ForgetAfter: time.Hour},
+		server.ThrottleIP:         {FreeAttempts: 20, BaseDelay: time.Second, MaxDelay: 5 * time.Minute, ForgetAfter: time.Hour},
+		server.ThrottleMFA:        {FreeAttempts: 3, BaseDelay: 5 * time.Second, MaxDelay: 15 * time.Minute, ForgetAfter: time.Hour},
+		server.ThrottleResetEmail: {FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, ForgetAfter: time.Hour},
+		server.ThrottleResetIP:    {FreeAttempts: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, ForgetAfter: time.Hour},
+	})
+	exporter, err := exports.NewExporter(repo, hub, getEnv("EXPORT_DIR", "data/exports"), 1000, 7*24*time.Hour)
+	if err != nil {
+		log.Fatalf("cannot initialize data exports %v", err)
+	}
+	go exporter.Run(context.Background())
+	var oidc *server.OIDCProvider
+	if config.OIDC.Issuer != "" {
+		oidc, err = server.NewOIDCProvider(context.Background(), config.OIDC, config.PublicUrl+"/login/oidc/callback")
+		if err != nil {
+			log.Fatalf("cannot initialize oidc provider %v", err)
+		}
+	}
+	notifier := notifications.NewNotifier(repo, hub)
+	reactionPublisher := reactions.NewPublisher(repo, hub, time.Second)
+	go reactionPublisher.Run(context.Background())
+	mail, err := newMailer()
+	if err != nil {
+		log.Fatalf("cannot initialize mailer %v", err)
+	}
 	bindRoutes := func(s server.Server, r *mux.Router) {
-		r.Use(middlewares.CheckAuthMiddleware(s, authorization))
-		r.Handle("/", handlers.HomeHandler(s)).Methods(http.MethodGet)
-		r.Handle("/signup", handlers.SignUpHandler(s, repo)).Methods(http.MethodPost)
-		r.Handle("/login", handlers.LoginHandler(s, repo, authorization)).Methods(http.MethodPost)
-		r.Handle("/me", handlers.MeHandler(s, repo, authorization)).Methods(http.MethodGet)
-		r.Handle("/posts", handlers.InsertPostHandler(s, repo, authorization)).Methods(http.MethodPost)
-		r.Handle("/posts/{id}", handlers.GetPostHandler(s, repo)).Methods(http.MethodGet)
-		r.Handle("/posts/{id}", handlers.UpdatePostHandler(s, repo, authorization)).Methods(http.MethodPut)
-		r.Handle("/posts/{id}", handlers.DeletePostHandler(s, repo, authorization)).Methods(http.MethodDelete)
-		r.Handle("/posts", handlers.GetPaginatedPostsHandler(s, repo)).Methods(http.MethodGet)
-		r.HandleFunc("/ws", s.Hub().HandleWebSocket)
+		policies := middlewares.NewRoutePolicies()
+		writePosts := middlewares.AuthPolicy{
+			Scopes:               []string{server.ScopePostsWrite},
+			RequireVerifiedEmail: s.Config().RequireVerifiedEmail.ToPost,
+		}
+		r.Use(middlewares.CheckAuthMiddleware(s, authorization, policies))
+		r.Use(middlewares.ImpersonationMiddleware(s, repo))
+		policies.Set(r.Handle("/", handlers.HomeHandler(s)).Methods(http.MethodGet), middlewares.Authenticated)
+		policies.Set(r.Handle("/.well-known/jwks.json", handlers.JWKSHandler(s, authorization)).Methods(http.MethodGet), middlewares.Public)
+		policies.Set(r.Handle("/signup", handlers.SignUpHandler(s, repo, repo, mail)).Methods(http.MethodPost), middlewares.Public)
+		policies.Set(r.Handle("/login", handlers.LoginHandler(s, repo, authorization, throttle, repo)).Methods(http.MethodPost), middlewares.Public)
+		policies.Set(r.Handle("/login/mfa", handlers.LoginMFAHandler(s, repo, repo, authorization, throttle, repo)).Methods(http.MethodPost), middlewares.Public)
+		if oidc != nil {
+			policies.Set(r.Handle("/login/oidc", handlers.OIDCLoginHandler(s, oidc, authorization)).Methods(http.MethodGet), middlewares.Public)
+			policies.Set(r.Handle("/login/oidc/callback", handlers.OIDCCallbackHandler(s, repo, repo, oidc, authorization, repo)).Methods(http.MethodGet), middlewares.Public)
+		}
+		policies.Set(r.Handle("/me/mfa/totp", handlers.EnrollTotpHandler(s, repo, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/mfa/totp/confirm", handlers.ConfirmTotpHandler(s, repo, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/mfa/totp", handlers.DisableTotpHandler(s, repo, repo, throttle, repo)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/verify", handlers.VerifyEmailHandler(s, repo, repo)).Methods(http.MethodGet), middlewares.Public)
+		policies.Set(r.Handle("/verify/resend", handlers.ResendEmailVerificationHandler(s, repo, repo, mail)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/password/forgot", handlers.ForgotPasswordHandler(s, repo, repo, mail, throttle, repo)).Methods(http.MethodPost), middlewares.Public)
+		policies.Set(r.Handle("/password/reset", handlers.ResetPasswordFormHandler(s)).Methods(http.MethodGet), middlewares.Public)
+		policies.Set(r.Handle("/password/reset", handlers.ResetPasswordHandler(s, repo, repo, authorization, repo)).Methods(http.MethodPost), middlewares.Public)
+		policies.Set(r.Handle("/logout", handlers.LogoutHandler(s, authorization)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/logout-all", handlers.LogoutAllHandler(s, authorization)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me", handlers.MeHandler(s, repo)).Methods(http.MethodGet), middlewares.Authenticated)
+		policies.Set(r.Handle("/me", handlers.UpdateProfileHandler(s, repo)).Methods(http.MethodPatch), middlewares.SessionOnly)
+		policies.Set(r.Handle("/users/{handle}", handlers.GetProfileHandler(s, repo, repo)).Methods(http.MethodGet), middlewares.Public)
+		policies.Set(r.Handle("/users/{handle}/follow", handlers.FollowHandler(s, repo, repo, repo, notifier)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/users/{handle}/follow", handlers.UnfollowHandler(s, repo, repo)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/users/{handle}/followers", handlers.GetFollowersHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.Public)
+		policies.Set(r.Handle("/users/{handle}/following", handlers.GetFollowingHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.Public)
+		policies.Set(r.Handle("/users/{handle}/block", handlers.BlockHandler(s, repo, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/users/{handle}/block", handlers.UnblockHandler(s, repo, repo)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/users/{handle}/mute", handlers.MuteHandler(s, repo, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/users/{handle}/mute", handlers.UnmuteHandler(s, repo, repo)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/blocks", handlers.GetBlockedUsersHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/mutes", handlers.GetMutedUsersHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/notifications", handlers.GetNotificationsHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/notifications/unread-count", handlers.GetUnreadNotificationCountHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/notifications/read", handlers.MarkNotificationsReadHandler(s, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/notifications/read-all", handlers.MarkAllNotificationsReadHandler(s, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/bookmarks", handlers.GetBookmarksHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/bookmarks/{id}", handlers.SaveBookmarkHandler(s, repo, repo, repo)).Methods(http.MethodPut), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/bookmarks/{id}", handlers.RemoveBookmarkHandler(s, repo)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/bookmark-collections", handlers.CreateBookmarkCollectionHandler(s, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/bookmark-collections", handlers.GetBookmarkCollectionsHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/bookmark-collections/{id}", handlers.RenameBookmarkCollectionHandler(s, repo)).Methods(http.MethodPatch), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/bookmark-collections/{id}", handlers.DeleteBookmarkCollectionHandler(s, repo)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/conversations", handlers.StartConversationHandler(s, repo, repo, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/conversations", handlers.GetConversationsHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/conversations/{id}", handlers.GetConversationHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/conversations/{id}/messages", handlers.GetMessagesHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/conversations/{id}/messages", handlers.SendMessageHandler(s, repo, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/conversations/{id}/read", handlers.MarkConversationReadHandler(s, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/timeline", handlers.TimelineHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.RequireScopes(server.ScopePostsRead))
+		policies.Set(r.Handle("/me", handlers.DeleteAccountHandler(s, repo, authorization)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/password", handlers.ChangePasswordHandler(s, repo, authorization)).Methods(http.MethodPut), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/email", handlers.ChangeEmailHandler(s, repo, repo, mail)).Methods(http.MethodPut), middlewares.SessionOnly)
+		policies.Set(r.Handle("/verify/email-change", handlers.ConfirmEmailChangeHandler(s, repo, repo, authorization)).Methods(http.MethodGet), middlewares.Public)
+		policies.Set(r.Handle("/me/export", handlers.ExportHandler(s, exporter)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/exports/{id}", handlers.ExportStatusHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/exports/{id}/download", handlers.ExportDownloadHandler(s, exporter)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/sessions", handlers.ListSessionsHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/sessions/{id}", handlers.RevokeSessionHandler(s, repo, authorization)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/api-keys", handlers.CreateApiKeyHandler(s, repo)).Methods(http.MethodPost), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/api-keys", handlers.ListApiKeysHandler(s, repo)).Methods(http.MethodGet), middlewares.SessionOnly)
+		policies.Set(r.Handle("/me/api-keys/{id}", handlers.RevokeApiKeyHandler(s, authorization)).Methods(http.MethodDelete), middlewares.SessionOnly)
+		policies.Set(r.Handle("/posts", handlers.InsertPostHandler(s, repo, repo, repo, notifier)).Methods(http.MethodPost), writePosts)
+		policies.Set(r.Handle("/posts/{id}", handlers.GetPostHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.RequireScopes(server.ScopePostsRead))
+		policies.Set(r.Handle("/posts/{id}", handlers.UpdatePostHandler(s, repo)).Methods(http.MethodPut), writePosts)
+		policies.Set(r.Handle("/posts/{id}", handlers.DeletePostHandler(s, repo)).Methods(http.MethodDelete), middlewares.RequireScopes(server.ScopePostsWrite))
+		policies.Set(r.Handle("/posts", handlers.GetPaginatedPostsHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.RequireScopes(server.ScopePostsRead))
+		policies.Set(r.Handle("/posts/{id}/repost", handlers.RepostHandler(s, repo, repo, repo, repo)).Methods(http.MethodPost), writePosts)
+		policies.Set(r.Handle("/posts/{id}/repost", handlers.UndoRepostHandler(s, repo)).Methods(http.MethodDelete), middlewares.RequireScopes(server.ScopePostsWrite))
+		policies.Set(r.Handle("/posts/{id}/quote", handlers.QuotePostHandler(s, repo, repo, repo, repo, notifier)).Methods(http.MethodPost), writePosts)
+		policies.Set(r.Handle("/posts/{id}/comments", handlers.InsertCommentHandler(s, repo, repo, repo, notifier)).Methods(http.MethodPost), writePosts)
+		policies.Set(r.Handle("/posts/{id}/comments", handlers.GetCommentsHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.RequireScopes(server.ScopePostsRead))
+		policies.Set(r.Handle("/posts/{id}/comments/{commentId}", handlers.GetCommentHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.RequireScopes(server.ScopePostsRead))
+		policies.Set(r.Handle("/posts/{id}/comments/{commentId}", handlers.UpdateCommentHandler(s, repo, repo)).Methods(http.MethodPut), writePosts)
+		policies.Set(r.Handle("/posts/{id}/comments/{commentId}", handlers.DeleteCommentHandler(s, repo)).Methods(http.MethodDelete), middlewares.RequireScopes(server.ScopePostsWrite))
+		policies.Set(r.Handle("/posts/{id}/reactions", handlers.GetReactionsHandler(s, repo, repo, repo)).Methods(http.MethodGet), middlewares.RequireScopes(server.ScopePostsRead))
+		policies.Set(r.Handle("/posts/{id}/reactions/{reaction}", handlers.ReactHandler(s, repo, repo, repo, reactionPublisher, notifier)).Methods(http.MethodPut), writePosts)
+		policies.Set(r.Handle("/posts/{id}/reactions/{reaction}", handlers.UnreactHandler(s, repo, repo, repo, reactionPublisher)).Methods(http.MethodDelete), middlewares.RequireScopes(server.ScopePostsWrite))
+		policies.Set(r.Handle("/admin/users/{id}/roles", handlers.GetUserRolesHandler(s, repo)).Methods(http.MethodGet), middlewares.AuthPolicy{RequireSession: true, Roles: []string{server.RoleAdmin}})
+		policies.Set(r.Handle("/admin/users/{id}/roles", handlers.GrantRoleHandler(s, repo)).Methods(http.MethodPost), middlewares.AuthPolicy{RequireSession: true, Roles: []string{server.RoleAdmin}})
+		policies.Set(r.Handle("/admin/users/{id}/roles/{role}", handlers.RevokeRoleHandler(s, repo, authorization)).Methods(http.MethodDelete), middlewares.AuthPolicy{RequireSession: true, Roles: []string{server.RoleAdmin}})
+		policies.Set(r.Handle("/admin/users/{id}/impersonate", handlers.ImpersonateUserHandler(s, repo, repo, authorization)).Methods(http.MethodPost), middlewares.AuthPolicy{RequireSession: true, Roles: []string{server.RoleAdmin}})
+		policies.Set(r.Handle("/admin/users/{id}/impersonation-audit", handlers.GetImpersonationAuditHandler(s, repo)).Methods(http.MethodGet), middlewares.AuthPolicy{RequireSession: true, Roles: []string{server.RoleAdmin}})
+		policies.Set(r.Handle("/ws", handlers.WebSocketHandler(s)), middlewares.Public)
+
+		err := policies.Validate(r)
+		if err != nil {
+			log.Fatalf("invalid route configuration %v", err)
+		}
 	}
 
 	s.Start(bindRoutes)
 }
+
+func getEnv(key string, defaultVal string) string {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	return val
+}
+
+func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		log.Fatalf("invalid duration for %s: %v", key, err)
+	}
+	return duration
+}
+
+func newMailer() (mailer.Mailer, error) {
+	switch getEnv("MAILER", "file") {
+	case "smtp":
+		return mailer.NewSMTPMailer(os.Getenv("SMTP_HOST"), getEnv("SMTP_PORT", "587"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("MAIL_FROM")), nil
+	case "file":
+		return mailer.NewFileMailer(getEnv("MAIL_DIR", "mail"))
+	case "memory":
+		return mailer.NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %s", os.Getenv("MAILER"))
+	}
+}
@@ -1,39 +1,173 @@
 package middlewares
 
 import (
+	"fmt"
+	"github.com/gorilla/mux"
 	server "go-rest-websockets/server"
+	"go-rest-websockets/websockets"
 	"net/http"
 	"strings"
 )
 
+// AuthPolicy declares who may reach a route. A principal needs any one of
+// Roles and every one of Scopes. RequireSession rejects API keys and
+// impersonation tokens, keeping account settings to the user themselves.
+type AuthPolicy struct {
+	Public               bool
+	RequireSession       bool
+	RequireVerifiedEmail bool
+	Roles                []string
+	Scopes               []string
+}
+
 var (
-	NoAuthNeeded = []string{"login", "signup", "ws"}
+	Public        = AuthPolicy{Public: true}
+	Authenticated = AuthPolicy{}
+	SessionOnly   = AuthPolicy{RequireSession: true}
 )
 
-func isAuthNeeded(uri string) bool {
-	for _, noNeededRoute := range NoAuthNeeded {
-		if strings.Contains(uri, noNeededRoute) {
-			return false
+func RequireRoles(roles ...string) AuthPolicy {
+	return AuthPolicy{Roles: roles}
+}
+
+func RequireScopes(scopes ...string) AuthPolicy {
+	return AuthPolicy{Scopes: scopes}
+}
+
+func (p AuthPolicy) check(principal *server.Principal) error {
+	if p.RequireSession && (principal.TokenId == "" || principal.IsImpersonated()) {
+		return fmt.Errorf("a session token is required")
+	}
+	if p.RequireVerifiedEmail && !principal.EmailVerified {
+		return fmt.Errorf("email address is not verified")
+	}
+	if len(p.Roles) > 0 {
+		hasRole := false
+		for _, role := range p.Roles {
+			if principal.HasRole(role) {
+				hasRole = true
+				break
+			}
+		}
+		if !hasRole {
+			return fmt.Errorf("forbidden")
 		}
 	}
+	for _, scope := range p.Scopes {
+		if !principal.HasScope(scope) {
+			return fmt.Errorf("missing scope %s", scope)
+		}
+	}
+	return nil
+}
+
+type RoutePolicies struct {
+	policies map[*mux.Route]AuthPolicy
+}
+
+func NewRoutePolicies() *RoutePolicies {
+	return &RoutePolicies{policies: make(map[*mux.Route]AuthPolicy)}
+}
+
+func (p *RoutePolicies) Set(route *mux.Route, policy AuthPolicy) *mux.Route {
+	p.policies[route] = policy
+	return route
+}
+
+func (p *RoutePolicies) Get(route *mux.Route) (AuthPolicy, bool) {
+	policy, ok := p.policies[route]
+	return policy, ok
+}
 
-	return true
+// Validate fails when a route of the router has no declared policy, so a
+// forgotten declaration is caught at startup instead of at request time.
+func (p *RoutePolicies) Validate(router *mux.Router) error {
+	var missing []string
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		if _, ok := p.policies[route]; !ok {
+			path, _ := route.GetPathTemplate()
+			methods, _ := route.GetMethods()
+			missing = append(missing, strings.TrimSpace(strings.Join(methods, ",")+" "+path))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("routes without auth policy: %s", strings.Join(missing, "; "))
+	}
+	return nil
 }
 
-func CheckAuthMiddleware(s server.Server, auth server.Authorization) func(http.Handler) http.Handler {
+func CheckAuthMiddleware(s server.Server, auth server.Authorization, policies *RoutePolicies) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !isAuthNeeded(r.RequestURI) {
+			policy, ok := policies.Get(mux.CurrentRoute(r))
+			if !ok {
+				http.Error(w, "route has no auth policy", http.StatusForbidden)
+				return
+			}
+
+			tokenString, fromCookie := credential(s, r)
+			// a cookie is sent by the browser on its own, so unsafe requests
+			// must prove they come from our client by echoing the csrf token
+			csrfFailed := fromCookie && !isSafeMethod(r.Method) && !server.ValidCSRFToken(r)
+			if policy.Public {
+				// public routes still see who is calling when a valid token is sent
+				if tokenString != "" && !csrfFailed {
+					if principal, err := auth.Authenticate(r.Context(), tokenString); err == nil {
+						r = r.WithContext(server.WithPrincipal(r.Context(), principal))
+					}
+				}
 				next.ServeHTTP(w, r)
 				return
 			}
-			tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-			_, err := auth.ParseAndVerifyToken(s.Config().JWTSecret, tokenString)
+
+			if csrfFailed {
+				http.Error(w, "invalid csrf token", http.StatusForbidden)
+				return
+			}
+			principal, err := auth.Authenticate(r.Context(), tokenString)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			next.ServeHTTP(w, r)
+			err = policy.check(principal)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			ctx := server.WithPrincipal(r.Context(), principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// credential reads the token from the Authorization header, with or without
+// the Bearer scheme, or from the websocket handshake protocols, and falls back
+// to the session cookie when enabled.
+func credential(s server.Server, r *http.Request) (string, bool) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		header = strings.TrimSpace(header[len("Bearer "):])
+	}
+	if token, ok := websockets.BearerToken(r); ok && header == "" {
+		header = token
+	}
+	if header != "" || !s.Config().SessionCookies.Enabled {
+		return header, false
+	}
+	cookie, err := r.Cookie(server.SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,181 @@
+package middlewares
+
+import (
+	"github.com/gorilla/mux"
+	"go-rest-websockets/models"
+	server "go-rest-websockets/server"
+	"go-rest-websockets/websockets"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthPolicyCheck(t *testing.T) {
+	session := &server.Principal{UserId: "user", TokenId: "token", EmailVerified: true}
+	unverified := &server.Principal{UserId: "user", TokenId: "token"}
+	apiKey := &server.Principal{UserId: "user", ApiKeyId: "key", Scopes: []string{server.ScopePostsRead}, EmailVerified: true}
+	impersonated := &server.Principal{UserId: "user", TokenId: "token", ActorId: "admin", EmailVerified: true}
+	moderator := &server.Principal{UserId: "user", TokenId: "token", Roles: []string{server.RoleModerator}}
+	admin := &server.Principal{UserId: "user", TokenId: "token", Roles: []string{server.RoleAdmin}}
+
+	cases := []struct {
+		name      string
+		policy    AuthPolicy
+		principal *server.Principal
+		allowed   bool
+	}{
+		{"authenticated session", Authenticated, session, true},
+		{"authenticated api key", Authenticated, apiKey, true},
+		{"session only with session", SessionOnly, session, true},
+		{"session only with api key", SessionOnly, apiKey, false},
+		{"session only impersonated", SessionOnly, impersonated, false},
+		{"verified email", AuthPolicy{RequireVerifiedEmail: true}, session, true},
+		{"unverified email", AuthPolicy{RequireVerifiedEmail: true}, unverified, false},
+		{"any of the roles", RequireRoles(server.RoleModerator, server.RoleAdmin), moderator, true},
+		{"missing role", RequireRoles(server.RoleAdmin), moderator, false},
+		{"admin role", RequireRoles(server.RoleAdmin), admin, true},
+		{"session is not scope restricted", RequireScopes(server.ScopePostsWrite), session, true},
+		{"api key with scope", RequireScopes(server.ScopePostsRead), apiKey, true},
+		{"api key without scope", RequireScopes(server.ScopePostsWrite), apiKey, false},
+		{"every scope is required", RequireScopes(server.ScopePostsRead, server.ScopePostsWrite), apiKey, false},
+	}
+	for _, c := range cases {
+		err := c.policy.check(c.principal)
+		if (err == nil) != c.allowed {
+			t.Errorf("%s: allowed is %v, want %v (%v)", c.name, err == nil, c.allowed, err)
+		}
+	}
+}
+
+type testServer struct {
+	config *server.Config
+}
+
+func (s testServer) Config() *server.Config {
+	return s.config
+}
+
+func (s testServer) Hub() *websockets.Hub {
+	return nil
+}
+
+func TestCheckAuthMiddlewareRoutes(t *testing.T) {
+	keys, err := server.LoadKeySet(t.TempDir(), server.AlgorithmEdDSA, 3*time.Hour, 2*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := server.NewAuthorization(keys, server.NewRevocationStore(nil, websockets.NewHub()), nil, nil)
+	// an impersonation token has no session, so signing one needs no repository
+	token, _, err := auth.SignImpersonationToken(&server.Principal{UserId: "admin"}, &models.User{Id: "user"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router := mux.NewRouter()
+	policies := NewRoutePolicies()
+	router.Use(CheckAuthMiddleware(testServer{&server.Config{}}, auth, policies))
+	policies.Set(router.Handle("/login", ok).Methods(http.MethodPost), Public)
+	policies.Set(router.Handle("/me", ok).Methods(http.MethodGet), SessionOnly)
+	policies.Set(router.Handle("/posts/{id}", ok).Methods(http.MethodGet), Authenticated)
+	router.Handle("/undeclared", ok)
+
+	cases := []struct {
+		method     string
+		path       string
+		credential string
+		status     int
+	}{
+		{http.MethodPost, "/login", "", http.StatusOK},
+		// the path contains a public route but is not one
+		{http.MethodGet, "/posts/login-tips", "", http.StatusUnauthorized},
+		{http.MethodGet, "/posts/login-tips", "invalid", http.StatusUnauthorized},
+		{http.MethodGet, "/posts/login-tips", "Bearer " + token, http.StatusOK},
+		{http.MethodGet, "/posts/login-tips", "protocol " + token, http.StatusOK},
+		{http.MethodGet, "/me", token, http.StatusForbidden},
+		{http.MethodGet, "/undeclared", token, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(c.method, c.path, nil)
+		if strings.HasPrefix(c.credential, "protocol ") {
+			// how browsers pass the token on websocket handshakes
+			request.Header.Set("Sec-WebSocket-Protocol", websockets.BearerProtocol+", "+strings.TrimPrefix(c.credential, "protocol "))
+		} else if c.credential != "" {
+			request.Header.Set("Authorization", c.credential)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s %s: status is %d, want %d", c.method, c.path, recorder.Code, c.status)
+		}
+	}
+}
+
+func TestCheckAuthMiddlewareSessionCookies(t *testing.T) {
+	keys, err := server.LoadKeySet(t.TempDir(), server.AlgorithmEdDSA, 3*time.Hour, 2*time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := server.NewAuthorization(keys, server.NewRevocationStore(nil, websockets.NewHub()), nil, nil)
+	token, _, err := auth.SignImpersonationToken(&server.Principal{UserId: "admin"}, &models.User{Id: "user"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the handler answers 200 for callers it knows and 204 for anonymous ones
+	known := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := server.PrincipalFromContext(r.Context()); !ok {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	newRouter := func(cookies bool) *mux.Router {
+		router := mux.NewRouter()
+		policies := NewRoutePolicies()
+		config := &server.Config{SessionCookies: server.SessionCookieConfig{Enabled: cookies}}
+		router.Use(CheckAuthMiddleware(testServer{config}, auth, policies))
+		policies.Set(router.Handle("/posts", known).Methods(http.MethodGet, http.MethodPost), Authenticated)
+		policies.Set(router.Handle("/public", known).Methods(http.MethodPost), Public)
+		return router
+	}
+	cases := []struct {
+		name    string
+		cookies bool
+		method  string
+		path    string
+		cookie  bool
+		header  string
+		bearer  bool
+		status  int
+	}{
+		{"reading with the cookie", true, http.MethodGet, "/posts", true, "", false, http.StatusOK},
+		{"writing without csrf token", true, http.MethodPost, "/posts", true, "", false, http.StatusForbidden},
+		{"writing with another csrf token", true, http.MethodPost, "/posts", true, "other", false, http.StatusForbidden},
+		{"writing with the csrf token", true, http.MethodPost, "/posts", true, "csrf", false, http.StatusOK},
+		// a bearer token is never sent by the browser on its own
+		{"writing with a bearer token", true, http.MethodPost, "/posts", false, "", true, http.StatusOK},
+		// a forged request to a public route runs anonymously
+		{"public route without csrf token", true, http.MethodPost, "/public", true, "", false, http.StatusNoContent},
+		{"public route with the csrf token", true, http.MethodPost, "/public", true, "csrf", false, http.StatusOK},
+		{"cookies disabled", false, http.MethodGet, "/posts", true, "", false, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(c.method, c.path, nil)
+		if c.cookie {
+			request.AddCookie(&http.Cookie{Name: server.SessionCookieName, Value: token})
+			request.AddCookie(&http.Cookie{Name: server.CSRFCookieName, Value: "csrf"})
+		}
+		if c.header != "" {
+			request.Header.Set(server.CSRFHeaderName, c.header)
+		}
+		if c.bearer {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		newRouter(c.cookies).ServeHTTP(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+	}
+}
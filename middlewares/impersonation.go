@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"log"
+	"net"
+	"net/http"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack keeps websocket upgrades working through the recorder.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// ImpersonationMiddleware records every request made with an impersonation
+// token and rejects unsafe requests when the token is read only. It must run
+// after CheckAuthMiddleware, which attaches the principal.
+func ImpersonationMiddleware(s server.Server, audit repository.ImpersonationAuditRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := server.PrincipalFromContext(r.Context())
+			if !ok || !principal.IsImpersonated() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			if principal.ReadOnly && !isSafeMethod(r.Method) {
+				http.Error(recorder, "impersonation is read only", http.StatusForbidden)
+			} else {
+				next.ServeHTTP(recorder, r)
+			}
+
+			path := r.URL.RequestURI()
+			if len(path) > 512 {
+				path = path[:512]
+			}
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			// the request context may already be canceled, but the entry must be kept
+			err = audit.InsertImpersonationAuditEntry(context.Background(), &models.ImpersonationAuditEntry{
+				ActorId: principal.ActorId,
+				UserId:  principal.UserId,
+				TokenId: principal.TokenId,
+				Method:  r.Method,
+				Path:    path,
+				Status:  recorder.status,
+				Ip:      ip,
+			})
+			if err != nil {
+				log.Printf("error recording impersonation audit entry %v", err)
+			}
+		})
+	}
+}
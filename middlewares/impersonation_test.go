@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type auditRepository struct {
+	repository.ImpersonationAuditRepository
+	entries []models.ImpersonationAuditEntry
+}
+
+func (r *auditRepository) InsertImpersonationAuditEntry(ctx context.Context, entry *models.ImpersonationAuditEntry) error {
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+func TestImpersonationMiddleware(t *testing.T) {
+	readOnly := &server.Principal{UserId: "user", TokenId: "token", ActorId: "admin", ReadOnly: true}
+	readWrite := &server.Principal{UserId: "user", TokenId: "token", ActorId: "admin"}
+	user := &server.Principal{UserId: "user", TokenId: "token"}
+	cases := []struct {
+		name      string
+		principal *server.Principal
+		method    string
+		status    int
+		audited   bool
+	}{
+		{"read only reading", readOnly, http.MethodGet, http.StatusOK, true},
+		{"read only writing", readOnly, http.MethodPost, http.StatusForbidden, true},
+		{"read only deleting", readOnly, http.MethodDelete, http.StatusForbidden, true},
+		{"read write writing", readWrite, http.MethodPost, http.StatusOK, true},
+		{"user writing", user, http.MethodPost, http.StatusOK, false},
+	}
+	for _, c := range cases {
+		audit := &auditRepository{}
+		handler := ImpersonationMiddleware(nil, audit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		request := httptest.NewRequest(c.method, "/posts", nil)
+		request = request.WithContext(server.WithPrincipal(request.Context(), c.principal))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != c.status {
+			t.Errorf("%s: status is %d, want %d", c.name, recorder.Code, c.status)
+		}
+		if (len(audit.entries) == 1) != c.audited {
+			t.Errorf("%s: %d audit entries, want audited %v", c.name, len(audit.entries), c.audited)
+			continue
+		}
+		if c.audited && (audit.entries[0].Status != c.status || audit.entries[0].ActorId != "admin") {
+			t.Errorf("%s: audit entry is %+v", c.name, audit.entries[0])
+		}
+	}
+}
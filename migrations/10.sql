@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS data_exports;
+
+CREATE TABLE data_exports
+(
+    id           VARCHAR(32) PRIMARY KEY,
+    user_id      VARCHAR(32) NOT NULL,
+    status       VARCHAR(16) NOT NULL,
+    error        TEXT,
+    created_at   TIMESTAMP   NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP,
+    expires_at   TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
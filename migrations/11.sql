@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS identities;
+
+CREATE TABLE identities
+(
+    issuer     VARCHAR(255) NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    user_id    VARCHAR(32)  NOT NULL,
+    email      VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX identities_user_id_idx ON identities (user_id);
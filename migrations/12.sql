@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS sessions;
+
+CREATE TABLE sessions
+(
+    id           VARCHAR(32)  PRIMARY KEY,
+    user_id      VARCHAR(32)  NOT NULL,
+    token_id     VARCHAR(32)  NOT NULL,
+    device       VARCHAR(255) NOT NULL,
+    user_agent   VARCHAR(512) NOT NULL,
+    ip           VARCHAR(64)  NOT NULL,
+    created_at   TIMESTAMP    NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP    NOT NULL DEFAULT NOW(),
+    expires_at   TIMESTAMP    NOT NULL,
+    revoked_at   TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id, last_seen_at);
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS impersonation_audit;
+
+CREATE TABLE impersonation_audit
+(
+    id         SERIAL PRIMARY KEY,
+    actor_id   VARCHAR(32)  NOT NULL,
+    user_id    VARCHAR(32)  NOT NULL,
+    token_id   VARCHAR(32)  NOT NULL,
+    method     VARCHAR(16)  NOT NULL,
+    path       VARCHAR(512) NOT NULL,
+    status     INTEGER      NOT NULL,
+    ip         VARCHAR(64)  NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX impersonation_audit_user_id_idx ON impersonation_audit (user_id, created_at);
+CREATE INDEX impersonation_audit_actor_id_idx ON impersonation_audit (actor_id, created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN handle       VARCHAR(30),
+    ADD COLUMN display_name VARCHAR(50)  NOT NULL DEFAULT '',
+    ADD COLUMN bio          VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url   VARCHAR(512) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX users_handle_idx ON users (LOWER(handle));
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS follows;
+
+CREATE TABLE follows
+(
+    follower_id VARCHAR(32) NOT NULL,
+    followee_id VARCHAR(32) NOT NULL,
+    created_at  TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    FOREIGN KEY (follower_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (followee_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows (followee_id, created_at);
+CREATE INDEX posts_user_id_created_at_idx ON posts (user_id, created_at DESC, id DESC);
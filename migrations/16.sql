@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS user_blocks;
+
+CREATE TABLE user_blocks
+(
+    blocker_id VARCHAR(32) NOT NULL,
+    blocked_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX user_blocks_blocked_id_idx ON user_blocks (blocked_id);
+
+DROP TABLE IF EXISTS user_mutes;
+
+CREATE TABLE user_mutes
+(
+    muter_id   VARCHAR(32) NOT NULL,
+    muted_id   VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (muter_id, muted_id),
+    FOREIGN KEY (muter_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (muter_id <> muted_id)
+);
+
+CREATE INDEX user_mutes_muted_id_idx ON user_mutes (muted_id);
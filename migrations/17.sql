@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS notifications;
+
+CREATE TABLE notifications
+(
+    id         VARCHAR(32) PRIMARY KEY,
+    user_id    VARCHAR(32) NOT NULL,
+    actor_id   VARCHAR(32) NOT NULL,
+    type       VARCHAR(32) NOT NULL,
+    entity_id  VARCHAR(32),
+    read_at    TIMESTAMP,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC, id DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,37 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversation_participants;
+DROP TABLE IF EXISTS conversations;
+
+CREATE TABLE conversations
+(
+    id              VARCHAR(32) PRIMARY KEY,
+    direct_key      VARCHAR(65) UNIQUE,
+    created_at      TIMESTAMP   NOT NULL DEFAULT NOW(),
+    last_message_at TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE conversation_participants
+(
+    conversation_id VARCHAR(32) NOT NULL,
+    user_id         VARCHAR(32) NOT NULL,
+    last_read_at    TIMESTAMP,
+    joined_at       TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversation_participants_user_id_idx ON conversation_participants (user_id);
+
+CREATE TABLE messages
+(
+    id              VARCHAR(32) PRIMARY KEY,
+    conversation_id VARCHAR(32) NOT NULL,
+    sender_id       VARCHAR(32) NOT NULL,
+    body            TEXT        NOT NULL,
+    created_at      TIMESTAMP   NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_id_idx ON messages (conversation_id, created_at DESC, id DESC);
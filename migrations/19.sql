@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS comments;
+
+CREATE TABLE comments
+(
+    id         VARCHAR(32) PRIMARY KEY,
+    post_id    VARCHAR(32) NOT NULL,
+    parent_id  VARCHAR(32),
+    user_id    VARCHAR(32) NOT NULL,
+    content    TEXT        NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX comments_post_id_idx ON comments (post_id, created_at, id);
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS revoked_tokens;
+
+CREATE TABLE revoked_tokens
+(
+    token_id   VARCHAR(32) PRIMARY KEY,
+    user_id    VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMP   NOT NULL,
+    revoked_at TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+
+DROP TABLE IF EXISTS user_token_revocations;
+
+CREATE TABLE user_token_revocations
+(
+    user_id        VARCHAR(32) PRIMARY KEY,
+    revoked_before TIMESTAMP   NOT NULL
+);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS post_reactions;
+
+CREATE TABLE post_reactions
+(
+    post_id    VARCHAR(32) NOT NULL,
+    user_id    VARCHAR(32) NOT NULL,
+    reaction   VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id, reaction),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_reactions_user_id_idx ON post_reactions (user_id);
@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS bookmark_collections;
+
+CREATE TABLE bookmark_collections
+(
+    id         VARCHAR(32)  PRIMARY KEY,
+    user_id    VARCHAR(32)  NOT NULL,
+    name       VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX bookmark_collections_user_id_name_idx ON bookmark_collections (user_id, LOWER(name));
+
+-- post_id has no foreign key so bookmarks outlive deleted posts and can be
+-- shown as unavailable instead of silently disappearing.
+CREATE TABLE bookmarks
+(
+    user_id       VARCHAR(32) NOT NULL,
+    post_id       VARCHAR(32) NOT NULL,
+    collection_id VARCHAR(32),
+    created_at    TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (collection_id) REFERENCES bookmark_collections (id) ON DELETE SET NULL
+);
+
+CREATE INDEX bookmarks_user_id_created_at_idx ON bookmarks (user_id, created_at DESC, post_id DESC);
+CREATE INDEX bookmarks_collection_id_idx ON bookmarks (collection_id);
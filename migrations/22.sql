@@ -0,0 +1,7 @@
+ALTER TABLE posts
+    ADD COLUMN post_type        VARCHAR(16) NOT NULL DEFAULT 'post',
+    ADD COLUMN original_post_id VARCHAR(32),
+    ADD FOREIGN KEY (original_post_id) REFERENCES posts (id) ON DELETE SET NULL;
+
+CREATE INDEX posts_original_post_id_idx ON posts (original_post_id);
+CREATE UNIQUE INDEX posts_repost_idx ON posts (user_id, original_post_id) WHERE post_type = 'repost';
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN totp_last_counter BIGINT;
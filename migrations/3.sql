@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS user_roles;
+
+CREATE TABLE user_roles
+(
+    user_id    VARCHAR(32) NOT NULL,
+    role       VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS api_keys;
+
+CREATE TABLE api_keys
+(
+    id           VARCHAR(32) PRIMARY KEY,
+    user_id      VARCHAR(32)  NOT NULL,
+    name         VARCHAR(255) NOT NULL,
+    key_hash     VARCHAR(64)  UNIQUE NOT NULL,
+    scopes       TEXT[]       NOT NULL,
+    expires_at   TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    created_at   TIMESTAMP    NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS user_tokens;
+
+CREATE TABLE user_tokens
+(
+    id         VARCHAR(32) PRIMARY KEY,
+    user_id    VARCHAR(32) NOT NULL,
+    purpose    VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP   NOT NULL,
+    used_at    TIMESTAMP,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- accounts created before verification existed keep working
+UPDATE users
+SET email_verified = TRUE;
@@ -0,0 +1,15 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret  VARCHAR(64),
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP TABLE IF EXISTS recovery_codes;
+
+CREATE TABLE recovery_codes
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    VARCHAR(32) NOT NULL,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMP,
+    created_at TIMESTAMP   NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS auth_events;
+
+CREATE TABLE auth_events
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    VARCHAR(32),
+    email      VARCHAR(255),
+    ip         VARCHAR(64)  NOT NULL,
+    event      VARCHAR(32)  NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX auth_events_user_id_idx ON auth_events (user_id, created_at);
@@ -0,0 +1,5 @@
+ALTER TABLE user_tokens
+    ADD COLUMN data VARCHAR(255);
+
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMP;
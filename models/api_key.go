@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type ApiKey struct {
+	Id         string     `json:"id"`
+	UserId     string     `json:"userId"`
+	Name       string     `json:"name"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	// OwnerEmailVerified mirrors the owner's account state when the key is
+	// looked up for authentication.
+	OwnerEmailVerified bool `json:"-"`
+}
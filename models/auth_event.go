@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	AuthEventLoginSucceeded         = "login_succeeded"
+	AuthEventLoginFailed            = "login_failed"
+	AuthEventLoginThrottled         = "login_throttled"
+	AuthEventMFAChallenged          = "mfa_challenged"
+	AuthEventMFAFailed              = "mfa_failed"
+	AuthEventMFAThrottled           = "mfa_throttled"
+	AuthEventMFADisabled            = "mfa_disabled"
+	AuthEventPasswordResetRequested = "password_reset_requested"
+	AuthEventPasswordReset          = "password_reset"
+	AuthEventIdentityLinked         = "identity_linked"
+)
+
+type AuthEvent struct {
+	Id        int64     `json:"id"`
+	UserId    string    `json:"userId"`
+	Email     string    `json:"email"`
+	Ip        string    `json:"ip"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type BookmarkCollection struct {
+	Id            string    `json:"id"`
+	UserId        string    `json:"-"`
+	Name          string    `json:"name"`
+	BookmarkCount int       `json:"bookmarkCount"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Bookmark is a post saved by a user, optionally filed in a collection. Post
+// is nil and Unavailable set when the post was deleted or the user no longer
+// sees it because of a block or mute.
+type Bookmark struct {
+	PostId       string    `json:"postId"`
+	CollectionId string    `json:"collectionId,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Post         *Post     `json:"post"`
+	Unavailable  bool      `json:"unavailable"`
+}
@@ -4,5 +4,12 @@ import "github.com/golang-jwt/jwt"
 
 type AppClaims struct {
 	jwt.StandardClaims
-	UserId string `json:"userId"`
+	UserId        string   `json:"userId"`
+	Roles         []string `json:"roles,omitempty"`
+	EmailVerified bool     `json:"emailVerified"`
+	SessionId     string   `json:"sid,omitempty"`
+	Actor         *Actor   `json:"act,omitempty"`
+	// IssuedAtNano is iat with nanosecond precision, so a token issued right
+	// after a revocation in the same second stays valid.
+	IssuedAtNano int64 `json:"iatNano,omitempty"`
 }
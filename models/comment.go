@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Comment is a comment on a post, or a reply to another comment of the same
+// post when ParentId is set.
+type Comment struct {
+	Id         string     `json:"id"`
+	PostId     string     `json:"postId"`
+	ParentId   string     `json:"parentId,omitempty"`
+	UserId     string     `json:"userId"`
+	Author     *Author    `json:"author,omitempty"`
+	Content    string     `json:"content"`
+	ReplyCount int        `json:"replyCount"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  *time.Time `json:"updatedAt"`
+}
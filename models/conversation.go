@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+type Conversation struct {
+	Id            string        `json:"id"`
+	Participants  []Participant `json:"participants"`
+	LastMessage   *Message      `json:"lastMessage"`
+	UnreadCount   int           `json:"unreadCount"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	LastMessageAt time.Time     `json:"lastMessageAt"`
+}
+
+// Participant carries the read receipt of a member of a conversation: every
+// message created up to LastReadAt has been read.
+type Participant struct {
+	Author
+	LastReadAt *time.Time `json:"lastReadAt"`
+}
+
+type Message struct {
+	Id             string    `json:"id"`
+	ConversationId string    `json:"conversationId"`
+	SenderId       string    `json:"senderId"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func (c *Conversation) HasParticipant(userId string) bool {
+	for _, participant := range c.Participants {
+		if participant.Id == userId {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Conversation) ParticipantIds() []string {
+	ids := make([]string, 0, len(c.Participants))
+	for _, participant := range c.Participants {
+		ids = append(ids, participant.Id)
+	}
+	return ids
+}
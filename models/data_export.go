@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	DataExportPending   = "pending"
+	DataExportCompleted = "completed"
+	DataExportFailed    = "failed"
+	// DataExportExpired marks completed exports whose archive was deleted
+	// after the retention period.
+	DataExportExpired = "expired"
+)
+
+type DataExport struct {
+	Id          string     `json:"id"`
+	UserId      string     `json:"userId"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
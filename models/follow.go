@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Follow is an entry of a follower or following list.
+type Follow struct {
+	Profile
+	FollowedAt time.Time `json:"followedAt"`
+}
+
+// Cursor points at the last item of a page ordered by creation time, newest
+// first. The id breaks ties between items created at the same time.
+type Cursor struct {
+	CreatedAt time.Time
+	Id        string
+}
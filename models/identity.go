@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Identity links an account at an external OpenID Connect provider to a user.
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserId    string    `json:"userId"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Actor is the act claim of an impersonation token, naming the admin acting
+// as the token subject.
+type Actor struct {
+	UserId   string `json:"sub"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+type ImpersonationAuditEntry struct {
+	Id        int64     `json:"id"`
+	ActorId   string    `json:"actorId"`
+	UserId    string    `json:"userId"`
+	TokenId   string    `json:"tokenId"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Ip        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	NotificationFollow   = "follow"
+	NotificationMention  = "mention"
+	NotificationComment  = "comment"
+	NotificationReaction = "reaction"
+)
+
+// Notification tells UserId that Actor did something. EntityId is the post or
+// comment it is about, empty for follows.
+type Notification struct {
+	Id        string     `json:"id"`
+	UserId    string     `json:"userId"`
+	Type      string     `json:"type"`
+	Actor     *Author    `json:"actor"`
+	EntityId  string     `json:"entityId,omitempty"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
@@ -2,9 +2,32 @@ package models
 
 import "time"
 
+const (
+	PostTypePost   = "post"
+	PostTypeRepost = "repost"
+	PostTypeQuote  = "quote"
+)
+
+// Post is either an original post, a repost sharing another post as is, or a
+// quote adding content to it. Reposts and quotes embed the post they share as
+// Original, which is nil and OriginalUnavailable set once it was deleted or
+// when a block or mute hides it from the viewer.
 type Post struct {
-	Id          string    `json:"id"`
-	PostContent string    `json:"postContent"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UserId      string    `json:"userId"`
+	Id                  string           `json:"id"`
+	PostContent         string           `json:"postContent"`
+	CreatedAt           time.Time        `json:"createdAt"`
+	UserId              string           `json:"userId"`
+	Author              *Author          `json:"author,omitempty"`
+	PostType            string           `json:"postType"`
+	OriginalPostId      string           `json:"originalPostId,omitempty"`
+	Original            *Post            `json:"original,omitempty"`
+	OriginalUnavailable bool             `json:"originalUnavailable,omitempty"`
+	CommentCount        int              `json:"commentCount"`
+	RepostCount         int              `json:"repostCount"`
+	QuoteCount          int              `json:"quoteCount"`
+	Reactions           *ReactionSummary `json:"reactions,omitempty"`
+}
+
+func (p *Post) IsShare() bool {
+	return p.PostType == PostTypeRepost || p.PostType == PostTypeQuote
 }
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	ReactionLike  = "like"
+	ReactionLove  = "love"
+	ReactionLaugh = "laugh"
+	ReactionWow   = "wow"
+	ReactionSad   = "sad"
+	ReactionAngry = "angry"
+)
+
+var Reactions = []string{ReactionLike, ReactionLove, ReactionLaugh, ReactionWow, ReactionSad, ReactionAngry}
+
+func IsKnownReaction(reaction string) bool {
+	for _, known := range Reactions {
+		if known == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// Reaction is one reaction left by a user on a post.
+type Reaction struct {
+	PostId    string    `json:"postId"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ReactionSummary counts the reactions to a post by type and lists the ones
+// left by the viewer.
+type ReactionSummary struct {
+	Counts map[string]int `json:"counts"`
+	Viewer []string       `json:"viewer"`
+}
+
+func NewReactionSummary() *ReactionSummary {
+	return &ReactionSummary{Counts: make(map[string]int), Viewer: make([]string, 0)}
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type RevokedToken struct {
+	TokenId   string    `json:"tokenId"`
+	UserId    string    `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type UserTokenRevocation struct {
+	UserId        string    `json:"userId"`
+	RevokedBefore time.Time `json:"revokedBefore"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is a login of a user on one device, backed by a single token.
+type Session struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"userId"`
+	TokenId    string    `json:"-"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"userAgent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// Current marks the session the listing was requested from.
+	Current bool `json:"current"`
+}
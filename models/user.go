@@ -1,7 +1,56 @@
 package models
 
+import "time"
+
 type User struct {
-	Id       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Id            string    `json:"id"`
+	Email         string    `json:"email"`
+	Password      string    `json:"password"`
+	EmailVerified bool      `json:"emailVerified"`
+	TotpSecret    string    `json:"-"`
+	TotpEnabled   bool      `json:"totpEnabled"`
+	Roles         []string  `json:"roles"`
+	Handle        string    `json:"handle"`
+	DisplayName   string    `json:"displayName"`
+	Bio           string    `json:"bio"`
+	AvatarUrl     string    `json:"avatarUrl"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Profile is the public view of a user.
+type Profile struct {
+	Id          string    `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"displayName"`
+	Bio         string    `json:"bio"`
+	AvatarUrl   string    `json:"avatarUrl"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Author is the part of a profile embedded in the content a user created.
+type Author struct {
+	Id          string `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	AvatarUrl   string `json:"avatarUrl"`
+}
+
+func (u *User) Profile() Profile {
+	return Profile{
+		Id:          u.Id,
+		Handle:      u.Handle,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarUrl:   u.AvatarUrl,
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+func (u *User) Author() *Author {
+	return &Author{
+		Id:          u.Id,
+		Handle:      u.Handle,
+		DisplayName: u.DisplayName,
+		AvatarUrl:   u.AvatarUrl,
+	}
 }
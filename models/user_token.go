@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+	UserTokenEmailChange       = "email_change"
+)
+
+// UserToken is a single use token mailed to a user, stored by its hash.
+type UserToken struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"userId"`
+	Purpose   string    `json:"purpose"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Data carries purpose specific state, such as the new address of an email change.
+	Data string `json:"-"`
+}
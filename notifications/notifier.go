@@ -0,0 +1,112 @@
+package notifications
+
+import (
+	"context"
+	"github.com/segmentio/ksuid"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/websockets"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const maxMentions = 10
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@])@([a-zA-Z0-9_]{3,30})\b`)
+
+type Source interface {
+	repository.Repository
+	repository.BlockRepository
+	repository.NotificationRepository
+}
+
+type NotificationEvent struct {
+	Notification *models.Notification `json:"notification"`
+	UnreadCount  int                  `json:"unreadCount"`
+}
+
+// Notifier stores notifications and pushes each one to the websocket
+// sessions of its recipient. Failures are logged rather than returned, a
+// missing notification must never fail the action that caused it.
+type Notifier struct {
+	source Source
+	hub    *websockets.Hub
+}
+
+func NewNotifier(source Source, hub *websockets.Hub) *Notifier {
+	return &Notifier{source: source, hub: hub}
+}
+
+// Notify tells recipientId that actorId did something of the given type.
+// Nothing is sent to the actor themselves or when a block or mute hides the
+// actor from the recipient.
+func (n *Notifier) Notify(ctx context.Context, recipientId string, actorId string, notificationType string, entityId string) {
+	if recipientId == actorId {
+		return
+	}
+	hidden, err := n.source.IsHiddenFrom(ctx, recipientId, actorId)
+	if err != nil {
+		log.Printf("error checking notification visibility %v", err)
+		return
+	}
+	if hidden {
+		return
+	}
+	actor, err := n.source.GetUserById(ctx, actorId)
+	if err != nil {
+		log.Printf("error loading notification actor %v", err)
+		return
+	}
+
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		log.Printf("error generating notification id %v", err)
+		return
+	}
+	notification := &models.Notification{
+		Id:       id.String(),
+		UserId:   recipientId,
+		Type:     notificationType,
+		Actor:    actor.Author(),
+		EntityId: entityId,
+	}
+	err = n.source.InsertNotification(ctx, notification)
+	if err != nil {
+		log.Printf("error storing notification %v", err)
+		return
+	}
+
+	unread, err := n.source.CountUnreadNotifications(ctx, recipientId)
+	if err != nil {
+		log.Printf("error counting unread notifications %v", err)
+		return
+	}
+	n.hub.SendToUser(recipientId, models.WebsocketMessage{
+		Type:    "Notification_Created",
+		Payload: NotificationEvent{Notification: notification, UnreadCount: unread},
+	})
+}
+
+// NotifyMentions notifies every user mentioned as @handle in content.
+func (n *Notifier) NotifyMentions(ctx context.Context, actorId string, entityId string, content string) {
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if len(seen) == maxMentions {
+			return
+		}
+		handle := match[1]
+		if seen[strings.ToLower(handle)] {
+			continue
+		}
+		seen[strings.ToLower(handle)] = true
+		user, err := n.source.GetUserByHandle(ctx, handle)
+		if err != nil {
+			log.Printf("error resolving mention %s %v", handle, err)
+			continue
+		}
+		if user.Id != "" {
+			n.Notify(ctx, user.Id, actorId, models.NotificationMention, entityId)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"go-rest-websockets/models"
+	"go-rest-websockets/websockets"
+	"strings"
+	"testing"
+)
+
+// source knows users by handle, "muter" hides the actor from themselves, and
+// keeps the notifications stored.
+type source struct {
+	Source
+	notifications []*models.Notification
+}
+
+func (s *source) IsHiddenFrom(ctx context.Context, viewerId string, authorId string) (bool, error) {
+	return viewerId == "muter", nil
+}
+
+func (s *source) GetUserById(ctx context.Context, id string) (*models.User, error) {
+	return &models.User{Id: id, Handle: id}, nil
+}
+
+func (s *source) GetUserByHandle(ctx context.Context, handle string) (*models.User, error) {
+	if handle == "missing" {
+		return &models.User{}, nil
+	}
+	return &models.User{Id: strings.ToLower(handle), Handle: handle}, nil
+}
+
+func (s *source) InsertNotification(ctx context.Context, notification *models.Notification) error {
+	s.notifications = append(s.notifications, notification)
+	return nil
+}
+
+func (s *source) CountUnreadNotifications(ctx context.Context, userId string) (int, error) {
+	return len(s.notifications), nil
+}
+
+func (s *source) recipients() []string {
+	recipients := make([]string, 0, len(s.notifications))
+	for _, notification := range s.notifications {
+		recipients = append(recipients, notification.UserId)
+	}
+	return recipients
+}
+
+func TestNotify(t *testing.T) {
+	cases := []struct {
+		name        string
+		recipientId string
+		notified    bool
+	}{
+		{"recipient", "author", true},
+		{"actor themselves", "actor", false},
+		{"recipient hiding the actor", "muter", false},
+	}
+	for _, c := range cases {
+		s := &source{}
+		NewNotifier(s, websockets.NewHub()).Notify(context.Background(), c.recipientId, "actor", models.NotificationComment, "comment")
+		if (len(s.notifications) == 1) != c.notified {
+			t.Errorf("%s: notifications are %v, want notified %v", c.name, s.recipients(), c.notified)
+			continue
+		}
+		if c.notified && (s.notifications[0].Actor.Id != "actor" || s.notifications[0].EntityId != "comment") {
+			t.Errorf("%s: notification is %+v", c.name, s.notifications[0])
+		}
+	}
+}
+
+func TestNotifyMentions(t *testing.T) {
+	cases := []struct {
+		content    string
+		recipients string
+	}{
+		{"hi @jane and @john", "jane,john"},
+		{"@jane @Jane @JANE", "jane"},
+		{"mail jane@doe.com", ""},
+		{"@missing @actor @muter", ""},
+		{"@ab is too short", ""},
+	}
+	for _, c := range cases {
+		s := &source{}
+		NewNotifier(s, websockets.NewHub()).NotifyMentions(context.Background(), "actor", "post", c.content)
+		if got := strings.Join(s.recipients(), ","); got != c.recipients {
+			t.Errorf("%q notified %q, want %q", c.content, got, c.recipients)
+		}
+	}
+}
+
+func TestNotifyMentionsIsCapped(t *testing.T) {
+	mentions := make([]string, 0, maxMentions+5)
+	for i := 0; i < maxMentions+5; i++ {
+		mentions = append(mentions, fmt.Sprintf("@user%d", i))
+	}
+	s := &source{}
+	NewNotifier(s, websockets.NewHub()).NotifyMentions(context.Background(), "actor", "post", strings.Join(mentions, " "))
+	if len(s.notifications) != maxMentions {
+		t.Errorf("%d mentions notified, want %d", len(s.notifications), maxMentions)
+	}
+}
@@ -0,0 +1,83 @@
+package reactions
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/websockets"
+	"log"
+	"sync"
+	"time"
+)
+
+type CountsEvent struct {
+	PostId string         `json:"postId"`
+	Counts map[string]int `json:"counts"`
+}
+
+// Publisher pushes reaction counts to the subscribers of a post's topic.
+// Changes are coalesced: however many reactions a post receives during an
+// interval, its subscribers get a single Reactions_Updated event with the
+// counts at the end of it.
+type Publisher struct {
+	source   repository.ReactionRepository
+	hub      *websockets.Hub
+	interval time.Duration
+	mutex    sync.Mutex
+	pending  map[string]bool
+}
+
+func NewPublisher(source repository.ReactionRepository, hub *websockets.Hub, interval time.Duration) *Publisher {
+	return &Publisher{
+		source:   source,
+		hub:      hub,
+		interval: interval,
+		pending:  make(map[string]bool),
+	}
+}
+
+// Changed marks the counts of a post as due for the next push.
+func (p *Publisher) Changed(postId string) {
+	p.mutex.Lock()
+	p.pending[postId] = true
+	p.mutex.Unlock()
+}
+
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.flush(ctx)
+		}
+	}
+}
+
+func (p *Publisher) flush(ctx context.Context) {
+	p.mutex.Lock()
+	if len(p.pending) == 0 {
+		p.mutex.Unlock()
+		return
+	}
+	postIds := make([]string, 0, len(p.pending))
+	for postId := range p.pending {
+		postIds = append(postIds, postId)
+	}
+	p.pending = make(map[string]bool)
+	p.mutex.Unlock()
+
+	summaries, err := p.source.GetReactionSummaries(ctx, "", postIds)
+	if err != nil {
+		log.Printf("error loading reaction counts %v", err)
+		return
+	}
+	for postId, summary := range summaries {
+		p.hub.Publish(websockets.PostTopic(postId), models.WebsocketMessage{
+			Type:    "Reactions_Updated",
+			Payload: CountsEvent{PostId: postId, Counts: summary.Counts},
+		}, nil)
+	}
+}
@@ -0,0 +1,46 @@
+package reactions
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/websockets"
+	"sort"
+	"testing"
+	"time"
+)
+
+// source records the posts whose counts were loaded.
+type source struct {
+	repository.ReactionRepository
+	loads [][]string
+}
+
+func (s *source) GetReactionSummaries(ctx context.Context, viewerId string, postIds []string) (map[string]*models.ReactionSummary, error) {
+	sort.Strings(postIds)
+	s.loads = append(s.loads, postIds)
+	return map[string]*models.ReactionSummary{}, nil
+}
+
+func TestPublisherCoalescesChanges(t *testing.T) {
+	s := &source{}
+	publisher := NewPublisher(s, websockets.NewHub(), time.Hour)
+	publisher.flush(context.Background())
+	if len(s.loads) != 0 {
+		t.Fatal("counts loaded without changes")
+	}
+
+	for i := 0; i < 3; i++ {
+		publisher.Changed("first")
+	}
+	publisher.Changed("second")
+	publisher.flush(context.Background())
+	if len(s.loads) != 1 || len(s.loads[0]) != 2 || s.loads[0][0] != "first" || s.loads[0][1] != "second" {
+		t.Fatalf("loads are %v, want one load of both posts", s.loads)
+	}
+
+	publisher.flush(context.Background())
+	if len(s.loads) != 1 {
+		t.Errorf("pushed changes were pushed again: %v", s.loads)
+	}
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"time"
+)
+
+type ApiKeyRepository interface {
+	InsertApiKey(ctx context.Context, key *models2.ApiKey) error
+	GetApiKeysByUser(ctx context.Context, userId string) ([]models2.ApiKey, error)
+	GetApiKeyByHash(ctx context.Context, keyHash string) (*models2.ApiKey, error)
+	RevokeApiKey(ctx context.Context, id string, userId string) (bool, error)
+	// RevokeUserApiKeys revokes every live key of the user and returns their ids.
+	RevokeUserApiKeys(ctx context.Context, userId string) ([]string, error)
+	TouchApiKey(ctx context.Context, id string, usedAt time.Time) error
+}
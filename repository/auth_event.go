@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type AuthEventRepository interface {
+	InsertAuthEvent(ctx context.Context, event *models2.AuthEvent) error
+	ForEachAuthEventByUser(ctx context.Context, userId string, fn func(event models2.AuthEvent) error) error
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+// BlockRepository stores blocks, which hide two users from each other in both
+// directions, and mutes, which only hide the muted user from the muter.
+type BlockRepository interface {
+	Block(ctx context.Context, blockerId string, blockedId string) error
+	Unblock(ctx context.Context, blockerId string, blockedId string) error
+	Mute(ctx context.Context, muterId string, mutedId string) error
+	Unmute(ctx context.Context, muterId string, mutedId string) error
+	IsBlocked(ctx context.Context, userId string, otherUserId string) (bool, error)
+	IsHiddenFrom(ctx context.Context, viewerId string, authorId string) (bool, error)
+	GetBlockedUsers(ctx context.Context, userId string) ([]models2.Profile, error)
+	GetMutedUsers(ctx context.Context, userId string) ([]models2.Profile, error)
+	GetUsersHiding(ctx context.Context, authorId string) ([]string, error)
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	models2 "go-rest-websockets/models"
+)
+
+var ErrCollectionNameTaken = errors.New("a collection with this name already exists")
+
+type BookmarkRepository interface {
+	CreateBookmarkCollection(ctx context.Context, collection *models2.BookmarkCollection) error
+	GetBookmarkCollection(ctx context.Context, userId string, id string) (*models2.BookmarkCollection, error)
+	GetBookmarkCollections(ctx context.Context, userId string) ([]models2.BookmarkCollection, error)
+	RenameBookmarkCollection(ctx context.Context, userId string, id string, name string) (bool, error)
+	DeleteBookmarkCollection(ctx context.Context, userId string, id string) (bool, error)
+	SaveBookmark(ctx context.Context, userId string, postId string, collectionId string) error
+	RemoveBookmark(ctx context.Context, userId string, postId string) error
+	GetBookmarks(ctx context.Context, userId string, collectionId string, after *models2.Cursor, limit int) ([]models2.Bookmark, error)
+	// ForEachBookmarkByUser streams the bookmarks of a user without their posts.
+	ForEachBookmarkByUser(ctx context.Context, userId string, fn func(bookmark models2.Bookmark) error) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type CommentRepository interface {
+	InsertComment(ctx context.Context, comment *models2.Comment) error
+	GetCommentById(ctx context.Context, id string) (*models2.Comment, error)
+	GetComments(ctx context.Context, viewerId string, postId string, parentId string, after *models2.Cursor, limit int) ([]models2.Comment, error)
+	UpdateComment(ctx context.Context, comment *models2.Comment) (bool, error)
+	DeleteComment(ctx context.Context, comment *models2.Comment) (bool, error)
+	DeleteAnyComment(ctx context.Context, id string) (bool, error)
+	ForEachCommentByUser(ctx context.Context, userId string, fn func(comment models2.Comment) error) error
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"time"
+)
+
+type DataExportRepository interface {
+	InsertDataExport(ctx context.Context, export *models2.DataExport) error
+	UpdateDataExport(ctx context.Context, export *models2.DataExport) error
+	GetDataExport(ctx context.Context, id string, userId string) (*models2.DataExport, error)
+	GetPendingDataExport(ctx context.Context, userId string) (*models2.DataExport, error)
+	// FailStaleDataExports marks the exports still pending since before
+	// createdBefore as failed, their worker is gone.
+	FailStaleDataExports(ctx context.Context, createdBefore time.Time, message string) error
+	// ExpireDataExports marks the completed exports expired at now and returns
+	// their ids so the archives can be deleted.
+	ExpireDataExports(ctx context.Context, now time.Time) ([]string, error)
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type FollowRepository interface {
+	Follow(ctx context.Context, followerId string, followeeId string) (bool, error)
+	Unfollow(ctx context.Context, followerId string, followeeId string) error
+	GetFollowers(ctx context.Context, viewerId string, userId string, after *models2.Cursor, limit int) ([]models2.Follow, error)
+	GetFollowing(ctx context.Context, viewerId string, userId string, after *models2.Cursor, limit int) ([]models2.Follow, error)
+	GetFollowerIds(ctx context.Context, userId string) ([]string, error)
+	GetTimeline(ctx context.Context, userId string, after *models2.Cursor, limit int) ([]models2.Post, error)
+}
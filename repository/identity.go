@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type IdentityRepository interface {
+	GetIdentity(ctx context.Context, issuer string, subject string) (*models2.Identity, error)
+	GetIdentitiesByUser(ctx context.Context, userId string) ([]models2.Identity, error)
+	InsertIdentity(ctx context.Context, identity *models2.Identity) error
+	InsertUserWithIdentity(ctx context.Context, user *models2.User, identity *models2.Identity) error
+}
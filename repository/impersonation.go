@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type ImpersonationAuditRepository interface {
+	InsertImpersonationAuditEntry(ctx context.Context, entry *models2.ImpersonationAuditEntry) error
+	GetImpersonationAuditByUser(ctx context.Context, userId string, limit int) ([]models2.ImpersonationAuditEntry, error)
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"time"
+)
+
+// MessageRepository stores the direct conversations between users. Lookups
+// take the requesting user and only find conversations they take part in.
+type MessageRepository interface {
+	GetOrCreateDirectConversation(ctx context.Context, userId string, otherUserId string) (*models2.Conversation, error)
+	GetConversation(ctx context.Context, id string, userId string) (*models2.Conversation, error)
+	GetConversations(ctx context.Context, userId string, after *models2.Cursor, limit int) ([]models2.Conversation, error)
+	InsertMessage(ctx context.Context, message *models2.Message) error
+	GetMessages(ctx context.Context, conversationId string, after *models2.Cursor, limit int) ([]models2.Message, error)
+	// ForEachMessageByUser streams the messages of every conversation userId
+	// takes part in, whoever sent them.
+	ForEachMessageByUser(ctx context.Context, userId string, fn func(message models2.Message) error) error
+	MarkConversationRead(ctx context.Context, conversationId string, userId string) (time.Time, error)
+}
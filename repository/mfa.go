@@ -0,0 +1,13 @@
+package repository
+
+import "context"
+
+type MFARepository interface {
+	SetUserTotpSecret(ctx context.Context, userId string, secret string) error
+	EnableUserTotp(ctx context.Context, userId string, recoveryCodeHashes []string) error
+	DisableUserTotp(ctx context.Context, userId string) error
+	ConsumeRecoveryCode(ctx context.Context, userId string, codeHash string) (bool, error)
+	// UseTotpCounter records the time step of an accepted code and reports
+	// false when that step or a later one was already used.
+	UseTotpCounter(ctx context.Context, userId string, counter int64) (bool, error)
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type NotificationRepository interface {
+	InsertNotification(ctx context.Context, notification *models2.Notification) error
+	GetNotifications(ctx context.Context, userId string, unreadOnly bool, after *models2.Cursor, limit int) ([]models2.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userId string) (int, error)
+	ForEachNotificationByUser(ctx context.Context, userId string, fn func(notification models2.Notification) error) error
+	MarkNotificationsRead(ctx context.Context, userId string, ids []string) error
+	MarkAllNotificationsRead(ctx context.Context, userId string) error
+}
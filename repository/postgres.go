@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
-	_ "github.com/lib/pq"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
 	models2 "go-rest-websockets/models"
 	"log"
 )
@@ -12,9 +14,18 @@ type PostgresUserRepository struct {
 	db *sql.DB
 }
 
-func (p *PostgresUserRepository) GetPaginatedPosts(ctx context.Context, size, page int) ([]models2.Post, error) {
+// GetPaginatedPosts leaves out the posts hidden from viewerId by blocks and
+// mutes. An empty viewerId sees every post.
+func (p *PostgresUserRepository) GetPaginatedPosts(ctx context.Context, viewerId string, size, page int) ([]models2.Post, error) {
 	offset := page * size
-	rows, err := p.db.QueryContext(ctx, "SELECT id, post_content, created_at, user_id FROM posts LIMIT $1 OFFSET $2", size, offset)
+	if viewerId == "" {
+		return p.queryPosts(ctx, "SELECT "+postColumns+" FROM "+postTables+" LIMIT $1 OFFSET $2", size, offset)
+	}
+	return p.queryPosts(ctx, "SELECT "+postColumns+" FROM "+postTables+" WHERE "+hiddenAuthorCondition+" LIMIT $2 OFFSET $3", viewerId, size, offset)
+}
+
+func (p *PostgresUserRepository) queryPosts(ctx context.Context, query string, args ...interface{}) ([]models2.Post, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -26,14 +37,13 @@ func (p *PostgresUserRepository) GetPaginatedPosts(ctx context.Context, size, pa
 		}
 	}()
 
-	var posts = make([]models2.Post, 0, size)
+	var posts = make([]models2.Post, 0)
 	for rows.Next() {
-		var post = models2.Post{}
-		err := rows.Scan(&post.Id, &post.PostContent, &post.CreatedAt, &post.UserId)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, post)
+		posts = append(posts, *post)
 	}
 
 	err = rows.Err()
@@ -42,21 +52,80 @@ func (p *PostgresUserRepository) GetPaginatedPosts(ctx context.Context, size, pa
 	}
 
 	return posts, nil
+}
 
+func placeholder(position int) string {
+	return fmt.Sprintf("$%d", position)
 }
 
-func (p *PostgresUserRepository) DeletePost(ctx context.Context, post *models2.Post) error {
-	_, err := p.db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1 AND user_id = $2", post.Id, post.UserId)
-	return err
+// DeletePost reports whether a post of the user was deleted.
+func (p *PostgresUserRepository) DeletePost(ctx context.Context, post *models2.Post) (bool, error) {
+	return p.deletePosts(ctx, "id = $1 AND user_id = $2", post.Id, post.UserId)
+}
+
+func (p *PostgresUserRepository) DeleteAnyPost(ctx context.Context, id string) (bool, error) {
+	return p.deletePosts(ctx, "id = $1", id)
+}
+
+// deletePosts deletes the posts matching condition along with their reposts,
+// which have no content of their own. Quotes keep their content and lose the
+// reference to the original. It reports whether any post matched.
+func (p *PostgresUserRepository) deletePosts(ctx context.Context, condition string, args ...interface{}) (bool, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM posts WHERE post_type = 'repost' AND original_post_id IN (SELECT id FROM posts WHERE "+condition+")", args...)
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM posts WHERE "+condition, args...)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, tx.Commit()
+}
+
+// UpdatePost leaves reposts alone, they have no content to edit. It reports
+// whether a post of the user was updated.
+func (p *PostgresUserRepository) UpdatePost(ctx context.Context, post *models2.Post) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "UPDATE posts SET post_content = $1 WHERE id = $2 AND user_id = $3 AND post_type <> 'repost'", post.PostContent, post.Id, post.UserId)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+func (p *PostgresUserRepository) GetRepost(ctx context.Context, userId string, originalPostId string) (*models2.Post, error) {
+	posts, err := p.queryPosts(ctx, "SELECT "+postColumns+" FROM "+postTables+" WHERE p.user_id = $1 AND p.original_post_id = $2 AND p.post_type = 'repost'", userId, originalPostId)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return &models2.Post{}, nil
+	}
+	return &posts[0], nil
 }
 
-func (p *PostgresUserRepository) UpdatePost(ctx context.Context, post *models2.Post) error {
-	_, err := p.db.ExecContext(ctx, "UPDATE posts SET post_content = $1 WHERE id = $2 AND user_id = $3", post.PostContent, post.Id, post.UserId)
+func (p *PostgresUserRepository) DeleteRepost(ctx context.Context, userId string, originalPostId string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM posts WHERE user_id = $1 AND original_post_id = $2 AND post_type = 'repost'", userId, originalPostId)
 	return err
 }
 
 func (p *PostgresUserRepository) GetPostById(ctx context.Context, id string) (*models2.Post, error) {
-	rows, err := p.db.QueryContext(ctx, "SELECT id, post_content, created_at, user_id FROM posts WHERE id = $1", id)
+	rows, err := p.db.QueryContext(ctx, "SELECT "+postColumns+" FROM "+postTables+" WHERE p.id = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +137,9 @@ func (p *PostgresUserRepository) GetPostById(ctx context.Context, id string) (*m
 		}
 	}()
 
-	var post = models2.Post{}
+	var post = &models2.Post{}
 	for rows.Next() {
-		err := rows.Scan(&post.Id, &post.PostContent, &post.CreatedAt, &post.UserId)
+		post, err = scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -81,6 +150,48 @@ func (p *PostgresUserRepository) GetPostById(ctx context.Context, id string) (*m
 		return nil, err
 	}
 
+	return post, nil
+}
+
+// postTables joins posts p with their author u, and with the original o they
+// share and its author ou for reposts and quotes.
+const postTables = "posts p JOIN users u ON u.id = p.user_id LEFT JOIN posts o ON o.id = p.original_post_id LEFT JOIN users ou ON ou.id = o.user_id"
+
+const postColumns = `p.id, p.post_content, p.created_at, p.user_id, u.id, COALESCE(u.handle, ''), u.display_name, u.avatar_url,
+	p.post_type, COALESCE(p.original_post_id, ''),
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id),
+	(SELECT COUNT(*) FROM posts r WHERE r.original_post_id = p.id AND r.post_type = 'repost'),
+	(SELECT COUNT(*) FROM posts q WHERE q.original_post_id = p.id AND q.post_type = 'quote'),
+	o.id, o.post_content, o.created_at, o.user_id, o.post_type, ou.id, COALESCE(ou.handle, ''), ou.display_name, ou.avatar_url`
+
+func scanPost(rows *sql.Rows) (*models2.Post, error) {
+	var post = models2.Post{Author: &models2.Author{}}
+	var original struct {
+		id, content, userId, postType, authorId, handle, displayName, avatarUrl sql.NullString
+		createdAt                                                               sql.NullTime
+	}
+	err := rows.Scan(&post.Id, &post.PostContent, &post.CreatedAt, &post.UserId, &post.Author.Id, &post.Author.Handle, &post.Author.DisplayName, &post.Author.AvatarUrl,
+		&post.PostType, &post.OriginalPostId, &post.CommentCount, &post.RepostCount, &post.QuoteCount,
+		&original.id, &original.content, &original.createdAt, &original.userId, &original.postType, &original.authorId, &original.handle, &original.displayName, &original.avatarUrl)
+	if err != nil {
+		return nil, err
+	}
+	if original.id.Valid {
+		post.Original = &models2.Post{
+			Id:          original.id.String,
+			PostContent: original.content.String,
+			CreatedAt:   original.createdAt.Time,
+			UserId:      original.userId.String,
+			PostType:    original.postType.String,
+			Author: &models2.Author{
+				Id:          original.authorId.String,
+				Handle:      original.handle.String,
+				DisplayName: original.displayName.String,
+				AvatarUrl:   original.avatarUrl.String,
+			},
+		}
+	}
+	post.OriginalUnavailable = post.IsShare() && post.Original == nil
 	return &post, nil
 }
 
@@ -104,8 +215,22 @@ func (p PostgresUserRepository) InsertUser(ctx context.Context, user *models2.Us
 	return err
 }
 
+const userColumns = "id, email, password, email_verified, COALESCE(totp_secret, ''), totp_enabled, COALESCE(handle, ''), display_name, bio, avatar_url, created_at"
+
 func (p PostgresUserRepository) GetUserById(ctx context.Context, id string) (*models2.User, error) {
-	rows, err := p.db.QueryContext(ctx, "SELECT id, email FROM users WHERE id = $1", id)
+	return p.queryUser(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id)
+}
+
+func (p PostgresUserRepository) GetUserByEmail(ctx context.Context, email string) (*models2.User, error) {
+	return p.queryUser(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email)
+}
+
+func (p PostgresUserRepository) GetUserByHandle(ctx context.Context, handle string) (*models2.User, error) {
+	return p.queryUser(ctx, "SELECT "+userColumns+" FROM users WHERE LOWER(handle) = LOWER($1) AND deleted_at IS NULL", handle)
+}
+
+func (p PostgresUserRepository) queryUser(ctx context.Context, query string, args ...interface{}) (*models2.User, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
 
 	if err != nil {
 		return nil, err
@@ -120,7 +245,7 @@ func (p PostgresUserRepository) GetUserById(ctx context.Context, id string) (*mo
 
 	var user = models2.User{}
 	for rows.Next() {
-		err := rows.Scan(&user.Id, &user.Email)
+		err := rows.Scan(&user.Id, &user.Email, &user.Password, &user.EmailVerified, &user.TotpSecret, &user.TotpEnabled, &user.Handle, &user.DisplayName, &user.Bio, &user.AvatarUrl, &user.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -134,9 +259,120 @@ func (p PostgresUserRepository) GetUserById(ctx context.Context, id string) (*mo
 	return &user, nil
 }
 
-func (p PostgresUserRepository) GetUserByEmail(ctx context.Context, email string) (*models2.User, error) {
-	rows, err := p.db.QueryContext(ctx, "SELECT id, email, password FROM users WHERE email = $1", email)
+// UpdateUserProfile stores the editable profile fields, returning
+// ErrHandleTaken when another user already has the handle.
+func (p PostgresUserRepository) UpdateUserProfile(ctx context.Context, user *models2.User) error {
+	var handle interface{}
+	if user.Handle != "" {
+		handle = user.Handle
+	}
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET handle = $1, display_name = $2, bio = $3, avatar_url = $4 WHERE id = $5", handle, user.DisplayName, user.Bio, user.AvatarUrl, user.Id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrHandleTaken
+	}
+	return err
+}
 
+func (p PostgresUserRepository) InsertPost(ctx context.Context, post *models2.Post) error {
+	var originalPostId interface{}
+	if post.OriginalPostId != "" {
+		originalPostId = post.OriginalPostId
+	}
+	_, err := p.db.ExecContext(ctx, "INSERT INTO posts (id, post_content, user_id, post_type, original_post_id) VALUES ($1, $2, $3, $4, $5)", post.Id, post.PostContent, post.UserId, post.PostType, originalPostId)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrAlreadyReposted
+	}
+	return err
+}
+
+func (p PostgresUserRepository) UpdateUserPassword(ctx context.Context, userId string, password string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", password, userId)
+	return err
+}
+
+func (p PostgresUserRepository) SetUserEmailVerified(ctx context.Context, userId string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET email_verified = TRUE WHERE id = $1", userId)
+	return err
+}
+
+func (p PostgresUserRepository) UpdateUserEmail(ctx context.Context, userId string, email string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET email = $1, email_verified = TRUE WHERE id = $2", email, userId)
+	return err
+}
+
+func (p PostgresUserRepository) DeleteUser(ctx context.Context, userId string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM posts WHERE post_type = 'repost' AND original_post_id IN (SELECT id FROM posts WHERE user_id = $1)", userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM posts WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AnonymizeUser keeps the row, so content referencing the user survives, but
+// removes everything that identifies or authenticates the account.
+func (p PostgresUserRepository) AnonymizeUser(ctx context.Context, userId string, placeholderEmail string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET email = $1, password = '', email_verified = FALSE, totp_secret = NULL, totp_enabled = FALSE, handle = NULL, display_name = '', bio = '', avatar_url = '', deleted_at = NOW() WHERE id = $2", placeholderEmail, userId)
+	if err != nil {
+		return err
+	}
+	for _, statement := range []string{
+		"DELETE FROM user_roles WHERE user_id = $1",
+		"DELETE FROM api_keys WHERE user_id = $1",
+		"DELETE FROM user_tokens WHERE user_id = $1",
+		"DELETE FROM recovery_codes WHERE user_id = $1",
+		"DELETE FROM identities WHERE user_id = $1",
+		"DELETE FROM sessions WHERE user_id = $1",
+		"DELETE FROM bookmarks WHERE user_id = $1",
+		"DELETE FROM bookmark_collections WHERE user_id = $1",
+		"DELETE FROM follows WHERE follower_id = $1 OR followee_id = $1",
+		"DELETE FROM user_blocks WHERE blocker_id = $1",
+		"DELETE FROM user_mutes WHERE muter_id = $1",
+		"DELETE FROM notifications WHERE user_id = $1 OR actor_id = $1",
+		"DELETE FROM conversation_participants WHERE user_id = $1",
+		"DELETE FROM post_reactions WHERE user_id = $1",
+	} {
+		_, err = tx.ExecContext(ctx, statement, userId)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p PostgresUserRepository) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role", userId)
 	if err != nil {
 		return nil, err
 	}
@@ -148,12 +384,14 @@ func (p PostgresUserRepository) GetUserByEmail(ctx context.Context, email string
 		}
 	}()
 
-	var user = models2.User{}
+	var roles = make([]string, 0)
 	for rows.Next() {
-		err := rows.Scan(&user.Id, &user.Email, &user.Password)
+		var role string
+		err := rows.Scan(&role)
 		if err != nil {
 			return nil, err
 		}
+		roles = append(roles, role)
 	}
 
 	err = rows.Err()
@@ -161,10 +399,58 @@ func (p PostgresUserRepository) GetUserByEmail(ctx context.Context, email string
 		return nil, err
 	}
 
-	return &user, nil
+	return roles, nil
 }
 
-func (p PostgresUserRepository) InsertPost(ctx context.Context, post *models2.Post) error {
-	_, err := p.db.ExecContext(ctx, "INSERT INTO posts (id, post_content, user_id) VALUES ($1, $2, $3)", post.Id, post.PostContent, post.UserId)
+func (p PostgresUserRepository) AddUserRole(ctx context.Context, userId string, role string) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT DO NOTHING", userId, role)
+	return err
+}
+
+func (p PostgresUserRepository) HasUserWithRole(ctx context.Context, role string) (bool, error) {
+	var exists bool
+	err := p.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM user_roles WHERE role = $1)", role).Scan(&exists)
+	return exists, err
+}
+
+func (p PostgresUserRepository) RemoveUserRole(ctx context.Context, userId string, role string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role = $2", userId, role)
 	return err
 }
+
+func (p PostgresUserRepository) CountPostsByUser(ctx context.Context, userId string) (int, error) {
+	var count int
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE user_id = $1", userId).Scan(&count)
+	return count, err
+}
+
+// ForEachPostByUser streams the posts of a user so large accounts are never
+// loaded in memory at once.
+func (p PostgresUserRepository) ForEachPostByUser(ctx context.Context, userId string, fn func(post models2.Post) error) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, post_content, created_at, user_id, post_type, COALESCE(original_post_id, '') FROM posts WHERE user_id = $1 ORDER BY created_at", userId)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var post = models2.Post{}
+		err := rows.Scan(&post.Id, &post.PostContent, &post.CreatedAt, &post.UserId, &post.PostType, &post.OriginalPostId)
+		if err != nil {
+			return err
+		}
+		post.OriginalUnavailable = post.IsShare() && post.OriginalPostId == ""
+		err = fn(post)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
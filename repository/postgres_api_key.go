@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	models2 "go-rest-websockets/models"
+	"log"
+	"time"
+)
+
+func (p *PostgresUserRepository) InsertApiKey(ctx context.Context, key *models2.ApiKey) error {
+	var expiresAt interface{}
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.UTC()
+	}
+	return p.db.QueryRowContext(ctx, "INSERT INTO api_keys (id, user_id, name, key_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at",
+		key.Id, key.UserId, key.Name, key.KeyHash, pq.Array(key.Scopes), expiresAt).Scan(&key.CreatedAt)
+}
+
+func (p *PostgresUserRepository) GetApiKeysByUser(ctx context.Context, userId string) ([]models2.ApiKey, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var keys = make([]models2.ApiKey, 0)
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (p *PostgresUserRepository) GetApiKeyByHash(ctx context.Context, keyHash string) (*models2.ApiKey, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT k.id, k.user_id, k.name, k.scopes, k.expires_at, k.last_used_at, k.created_at, u.email_verified FROM api_keys k JOIN users u ON u.id = k.user_id WHERE k.key_hash = $1 AND k.revoked_at IS NULL", keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var key = &models2.ApiKey{}
+	for rows.Next() {
+		var ownerEmailVerified bool
+		key, err = scanApiKey(rows, &ownerEmailVerified)
+		if err != nil {
+			return nil, err
+		}
+		key.OwnerEmailVerified = ownerEmailVerified
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (p *PostgresUserRepository) RevokeApiKey(ctx context.Context, id string, userId string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", id, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (p *PostgresUserRepository) RevokeUserApiKeys(ctx context.Context, userId string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL RETURNING id", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var ids = make([]string, 0)
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (p *PostgresUserRepository) TouchApiKey(ctx context.Context, id string, usedAt time.Time) error {
+	// only write when the stored value is stale so busy keys do not update on every request
+	_, err := p.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2 - INTERVAL '1 minute')", id, usedAt.UTC())
+	return err
+}
+
+func scanApiKey(rows *sql.Rows, extra ...interface{}) (*models2.ApiKey, error) {
+	var key = models2.ApiKey{}
+	var expiresAt, lastUsedAt sql.NullTime
+	dest := append([]interface{}{&key.Id, &key.UserId, &key.Name, pq.Array(&key.Scopes), &expiresAt, &lastUsedAt, &key.CreatedAt}, extra...)
+	err := rows.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return &key, nil
+}
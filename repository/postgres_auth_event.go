@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	models2 "go-rest-websockets/models"
+	"log"
+)
+
+func (p *PostgresUserRepository) InsertAuthEvent(ctx context.Context, event *models2.AuthEvent) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO auth_events (user_id, email, ip, event) VALUES ($1, $2, $3, $4)",
+		sql.NullString{String: event.UserId, Valid: event.UserId != ""}, sql.NullString{String: event.Email, Valid: event.Email != ""}, event.Ip, event.Event)
+	return err
+}
+
+func (p *PostgresUserRepository) ForEachAuthEventByUser(ctx context.Context, userId string, fn func(event models2.AuthEvent) error) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, user_id, COALESCE(email, ''), ip, event, created_at FROM auth_events WHERE user_id = $1 ORDER BY created_at", userId)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var event = models2.AuthEvent{}
+		err := rows.Scan(&event.Id, &event.UserId, &event.Email, &event.Ip, &event.Event, &event.CreatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
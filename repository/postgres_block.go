@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	models2 "go-rest-websockets/models"
+	"log"
+)
+
+// hiddenAuthorCondition filters rows whose author, aliased u, is blocked by or
+// blocking the viewer, or muted by them. The viewer is the first query argument.
+const hiddenAuthorCondition = `NOT EXISTS (SELECT 1 FROM user_blocks b WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1))
+	AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = u.id)`
+
+// Block also drops the follows between both users, so neither keeps seeing
+// the other in their timeline.
+func (p *PostgresUserRepository) Block(ctx context.Context, blockerId string, blockedId string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", blockerId, blockedId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM follows WHERE (follower_id = $1 AND followee_id = $2) OR (follower_id = $2 AND followee_id = $1)", blockerId, blockedId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresUserRepository) Unblock(ctx context.Context, blockerId string, blockedId string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", blockerId, blockedId)
+	return err
+}
+
+func (p *PostgresUserRepository) Mute(ctx context.Context, muterId string, mutedId string) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", muterId, mutedId)
+	return err
+}
+
+func (p *PostgresUserRepository) Unmute(ctx context.Context, muterId string, mutedId string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2", muterId, mutedId)
+	return err
+}
+
+// IsBlocked reports whether either user blocked the other.
+func (p *PostgresUserRepository) IsBlocked(ctx context.Context, userId string, otherUserId string) (bool, error) {
+	var blocked bool
+	err := p.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM user_blocks WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1))", userId, otherUserId).Scan(&blocked)
+	return blocked, err
+}
+
+// IsHiddenFrom reports whether content by authorId is hidden from viewerId by
+// a block in either direction or a mute by the viewer.
+func (p *PostgresUserRepository) IsHiddenFrom(ctx context.Context, viewerId string, authorId string) (bool, error) {
+	var visible bool
+	err := p.db.QueryRowContext(ctx, "SELECT "+hiddenAuthorCondition+" FROM users u WHERE u.id = $2", viewerId, authorId).Scan(&visible)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	return !visible, err
+}
+
+func (p *PostgresUserRepository) GetBlockedUsers(ctx context.Context, userId string) ([]models2.Profile, error) {
+	return p.queryProfiles(ctx, "SELECT u.id, COALESCE(u.handle, ''), u.display_name, u.bio, u.avatar_url, u.created_at FROM user_blocks b JOIN users u ON u.id = b.blocked_id WHERE b.blocker_id = $1 ORDER BY b.created_at DESC", userId)
+}
+
+func (p *PostgresUserRepository) GetMutedUsers(ctx context.Context, userId string) ([]models2.Profile, error) {
+	return p.queryProfiles(ctx, "SELECT u.id, COALESCE(u.handle, ''), u.display_name, u.bio, u.avatar_url, u.created_at FROM user_mutes m JOIN users u ON u.id = m.muted_id WHERE m.muter_id = $1 ORDER BY m.created_at DESC", userId)
+}
+
+func (p *PostgresUserRepository) queryProfiles(ctx context.Context, query string, args ...interface{}) ([]models2.Profile, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var profiles = make([]models2.Profile, 0)
+	for rows.Next() {
+		var profile = models2.Profile{}
+		err := rows.Scan(&profile.Id, &profile.Handle, &profile.DisplayName, &profile.Bio, &profile.AvatarUrl, &profile.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// GetUsersHiding returns the users who must not receive content by authorId:
+// everyone blocking or blocked by the author and everyone muting them.
+func (p *PostgresUserRepository) GetUsersHiding(ctx context.Context, authorId string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT blocker_id FROM user_blocks WHERE blocked_id = $1
+		UNION SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+		UNION SELECT muter_id FROM user_mutes WHERE muted_id = $1`, authorId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var ids = make([]string, 0)
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
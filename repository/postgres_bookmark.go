@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	models2 "go-rest-websockets/models"
+	"log"
+	"strings"
+)
+
+const bookmarkCollectionColumns = "bc.id, bc.user_id, bc.name, bc.created_at, (SELECT COUNT(*) FROM bookmarks b WHERE b.collection_id = bc.id)"
+
+func (p *PostgresUserRepository) CreateBookmarkCollection(ctx context.Context, collection *models2.BookmarkCollection) error {
+	err := p.db.QueryRowContext(ctx, "INSERT INTO bookmark_collections (id, user_id, name) VALUES ($1, $2, $3) RETURNING created_at",
+		collection.Id, collection.UserId, collection.Name).Scan(&collection.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrCollectionNameTaken
+	}
+	return err
+}
+
+func (p *PostgresUserRepository) GetBookmarkCollection(ctx context.Context, userId string, id string) (*models2.BookmarkCollection, error) {
+	collections, err := p.queryBookmarkCollections(ctx, "SELECT "+bookmarkCollectionColumns+" FROM bookmark_collections bc WHERE bc.user_id = $1 AND bc.id = $2", userId, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return &models2.BookmarkCollection{}, nil
+	}
+	return &collections[0], nil
+}
+
+func (p *PostgresUserRepository) GetBookmarkCollections(ctx context.Context, userId string) ([]models2.BookmarkCollection, error) {
+	return p.queryBookmarkCollections(ctx, "SELECT "+bookmarkCollectionColumns+" FROM bookmark_collections bc WHERE bc.user_id = $1 ORDER BY LOWER(bc.name)", userId)
+}
+
+func (p *PostgresUserRepository) queryBookmarkCollections(ctx context.Context, query string, args ...interface{}) ([]models2.BookmarkCollection, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var collections = make([]models2.BookmarkCollection, 0)
+	for rows.Next() {
+		var collection = models2.BookmarkCollection{}
+		err := rows.Scan(&collection.Id, &collection.UserId, &collection.Name, &collection.CreatedAt, &collection.BookmarkCount)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+func (p *PostgresUserRepository) RenameBookmarkCollection(ctx context.Context, userId string, id string, name string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "UPDATE bookmark_collections SET name = $1 WHERE id = $2 AND user_id = $3", name, id, userId)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return false, ErrCollectionNameTaken
+	}
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// DeleteBookmarkCollection keeps the bookmarks of the collection, they are
+// left unfiled.
+func (p *PostgresUserRepository) DeleteBookmarkCollection(ctx context.Context, userId string, id string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// SaveBookmark bookmarks the post, or moves an existing bookmark to the
+// collection. An empty collectionId leaves the bookmark unfiled.
+func (p *PostgresUserRepository) SaveBookmark(ctx context.Context, userId string, postId string, collectionId string) error {
+	var collection interface{}
+	if collectionId != "" {
+		collection = collectionId
+	}
+	_, err := p.db.ExecContext(ctx, "INSERT INTO bookmarks (user_id, post_id, collection_id) VALUES ($1, $2, $3) ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id",
+		userId, postId, collection)
+	return err
+}
+
+func (p *PostgresUserRepository) RemoveBookmark(ctx context.Context, userId string, postId string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2", userId, postId)
+	return err
+}
+
+// GetBookmarks pages through the bookmarks of a user, most recent first,
+// limited to a collection when collectionId is set. The posts are loaded as
+// seen by the user, so deleted posts and posts hidden by blocks or mutes come
+// back as unavailable.
+func (p *PostgresUserRepository) GetBookmarks(ctx context.Context, userId string, collectionId string, after *models2.Cursor, limit int) ([]models2.Bookmark, error) {
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{userId}
+	if collectionId != "" {
+		args = append(args, collectionId)
+		conditions = append(conditions, "collection_id = "+placeholder(len(args)))
+	}
+	if after != nil {
+		args = append(args, after.CreatedAt.UTC(), after.Id)
+		conditions = append(conditions, "(created_at, post_id) < ("+placeholder(len(args)-1)+", "+placeholder(len(args))+")")
+	}
+	args = append(args, limit)
+	rows, err := p.db.QueryContext(ctx, "SELECT post_id, COALESCE(collection_id, ''), created_at FROM bookmarks WHERE "+strings.Join(conditions, " AND ")+
+		" ORDER BY created_at DESC, post_id DESC LIMIT "+placeholder(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var bookmarks = make([]models2.Bookmark, 0)
+	var postIds = make([]string, 0)
+	for rows.Next() {
+		var bookmark = models2.Bookmark{}
+		err := rows.Scan(&bookmark.PostId, &bookmark.CollectionId, &bookmark.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, bookmark)
+		postIds = append(postIds, bookmark.PostId)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bookmarks) == 0 {
+		return bookmarks, nil
+	}
+	posts, err := p.queryPosts(ctx, "SELECT "+postColumns+" FROM "+postTables+" WHERE "+hiddenAuthorCondition+" AND p.id = ANY($2)", userId, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]*models2.Post, len(posts))
+	for i := range posts {
+		byId[posts[i].Id] = &posts[i]
+	}
+	for i := range bookmarks {
+		bookmarks[i].Post = byId[bookmarks[i].PostId]
+		bookmarks[i].Unavailable = bookmarks[i].Post == nil
+	}
+	return bookmarks, nil
+}
+
+func (p *PostgresUserRepository) ForEachBookmarkByUser(ctx context.Context, userId string, fn func(bookmark models2.Bookmark) error) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT post_id, COALESCE(collection_id, ''), created_at FROM bookmarks WHERE user_id = $1 ORDER BY created_at", userId)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var bookmark = models2.Bookmark{}
+		err := rows.Scan(&bookmark.PostId, &bookmark.CollectionId, &bookmark.CreatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(bookmark)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	models2 "go-rest-websockets/models"
+	"log"
+	"strings"
+)
+
+const commentColumns = `c.id, c.post_id, COALESCE(c.parent_id, ''), c.user_id, c.content, c.created_at, c.updated_at,
+	u.id, COALESCE(u.handle, ''), u.display_name, u.avatar_url,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id)`
+
+func (p *PostgresUserRepository) InsertComment(ctx context.Context, comment *models2.Comment) error {
+	var parentId interface{}
+	if comment.ParentId != "" {
+		parentId = comment.ParentId
+	}
+	return p.db.QueryRowContext(ctx, "INSERT INTO comments (id, post_id, parent_id, user_id, content) VALUES ($1, $2, $3, $4, $5) RETURNING created_at",
+		comment.Id, comment.PostId, parentId, comment.UserId, comment.Content).Scan(&comment.CreatedAt)
+}
+
+func (p *PostgresUserRepository) GetCommentById(ctx context.Context, id string) (*models2.Comment, error) {
+	comments, err := p.queryComments(ctx, "SELECT "+commentColumns+" FROM comments c JOIN users u ON u.id = c.user_id WHERE c.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return &models2.Comment{}, nil
+	}
+	return &comments[0], nil
+}
+
+// GetComments pages through the comments of a post oldest first, the top
+// level ones when parentId is empty and the replies to parentId otherwise.
+// Comments hidden from viewerId by blocks and mutes are left out.
+func (p *PostgresUserRepository) GetComments(ctx context.Context, viewerId string, postId string, parentId string, after *models2.Cursor, limit int) ([]models2.Comment, error) {
+	var conditions []string
+	var args []interface{}
+	if viewerId != "" {
+		conditions = append(conditions, hiddenAuthorCondition)
+		args = append(args, viewerId)
+	}
+	args = append(args, postId)
+	conditions = append(conditions, "c.post_id = "+placeholder(len(args)))
+	if parentId == "" {
+		conditions = append(conditions, "c.parent_id IS NULL")
+	} else {
+		args = append(args, parentId)
+		conditions = append(conditions, "c.parent_id = "+placeholder(len(args)))
+	}
+	if after != nil {
+		args = append(args, after.CreatedAt.UTC(), after.Id)
+		conditions = append(conditions, "(c.created_at, c.id) > ("+placeholder(len(args)-1)+", "+placeholder(len(args))+")")
+	}
+	args = append(args, limit)
+	query := "SELECT " + commentColumns + " FROM comments c JOIN users u ON u.id = c.user_id WHERE " + strings.Join(conditions, " AND ") +
+		" ORDER BY c.created_at, c.id LIMIT " + placeholder(len(args))
+	return p.queryComments(ctx, query, args...)
+}
+
+func (p *PostgresUserRepository) queryComments(ctx context.Context, query string, args ...interface{}) ([]models2.Comment, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var comments = make([]models2.Comment, 0)
+	for rows.Next() {
+		var comment = models2.Comment{Author: &models2.Author{}}
+		var updatedAt sql.NullTime
+		err := rows.Scan(&comment.Id, &comment.PostId, &comment.ParentId, &comment.UserId, &comment.Content, &comment.CreatedAt, &updatedAt,
+			&comment.Author.Id, &comment.Author.Handle, &comment.Author.DisplayName, &comment.Author.AvatarUrl, &comment.ReplyCount)
+		if err != nil {
+			return nil, err
+		}
+		if updatedAt.Valid {
+			comment.UpdatedAt = &updatedAt.Time
+		}
+		comments = append(comments, comment)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// UpdateComment changes the content of a comment owned by comment.UserId and
+// reports whether there was one.
+func (p *PostgresUserRepository) UpdateComment(ctx context.Context, comment *models2.Comment) (bool, error) {
+	var updatedAt sql.NullTime
+	err := p.db.QueryRowContext(ctx, "UPDATE comments SET content = $1, updated_at = NOW() WHERE id = $2 AND user_id = $3 RETURNING updated_at",
+		comment.Content, comment.Id, comment.UserId).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	comment.UpdatedAt = &updatedAt.Time
+	return true, nil
+}
+
+// DeleteComment removes a comment owned by comment.UserId, along with its
+// replies, and reports whether there was one.
+func (p *PostgresUserRepository) DeleteComment(ctx context.Context, comment *models2.Comment) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM comments WHERE id = $1 AND user_id = $2", comment.Id, comment.UserId)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (p *PostgresUserRepository) DeleteAnyComment(ctx context.Context, id string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM comments WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (p *PostgresUserRepository) ForEachCommentByUser(ctx context.Context, userId string, fn func(comment models2.Comment) error) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, post_id, COALESCE(parent_id, ''), user_id, content, created_at, updated_at FROM comments WHERE user_id = $1 ORDER BY created_at", userId)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var comment = models2.Comment{}
+		var updatedAt sql.NullTime
+		err := rows.Scan(&comment.Id, &comment.PostId, &comment.ParentId, &comment.UserId, &comment.Content, &comment.CreatedAt, &updatedAt)
+		if err != nil {
+			return err
+		}
+		if updatedAt.Valid {
+			comment.UpdatedAt = &updatedAt.Time
+		}
+		err = fn(comment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
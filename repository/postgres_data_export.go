@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	models2 "go-rest-websockets/models"
+	"log"
+	"time"
+)
+
+func (p *PostgresUserRepository) InsertDataExport(ctx context.Context, export *models2.DataExport) error {
+	return p.db.QueryRowContext(ctx, "INSERT INTO data_exports (id, user_id, status) VALUES ($1, $2, $3) RETURNING created_at",
+		export.Id, export.UserId, export.Status).Scan(&export.CreatedAt)
+}
+
+func (p *PostgresUserRepository) UpdateDataExport(ctx context.Context, export *models2.DataExport) error {
+	var completedAt, expiresAt sql.NullTime
+	if export.CompletedAt != nil {
+		completedAt = sql.NullTime{Time: export.CompletedAt.UTC(), Valid: true}
+	}
+	if export.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: export.ExpiresAt.UTC(), Valid: true}
+	}
+	_, err := p.db.ExecContext(ctx, "UPDATE data_exports SET status = $1, error = $2, completed_at = $3, expires_at = $4 WHERE id = $5",
+		export.Status, sql.NullString{String: export.Error, Valid: export.Error != ""}, completedAt, expiresAt, export.Id)
+	return err
+}
+
+func (p *PostgresUserRepository) GetDataExport(ctx context.Context, id string, userId string) (*models2.DataExport, error) {
+	return p.queryDataExport(ctx, "SELECT id, user_id, status, COALESCE(error, ''), created_at, completed_at, expires_at FROM data_exports WHERE id = $1 AND user_id = $2", id, userId)
+}
+
+func (p *PostgresUserRepository) GetPendingDataExport(ctx context.Context, userId string) (*models2.DataExport, error) {
+	return p.queryDataExport(ctx, "SELECT id, user_id, status, COALESCE(error, ''), created_at, completed_at, expires_at FROM data_exports WHERE user_id = $1 AND status = $2 ORDER BY created_at DESC LIMIT 1", userId, models2.DataExportPending)
+}
+
+func (p *PostgresUserRepository) FailStaleDataExports(ctx context.Context, createdBefore time.Time, message string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE data_exports SET status = $1, error = $2, completed_at = NOW() WHERE status = $3 AND created_at < $4",
+		models2.DataExportFailed, message, models2.DataExportPending, createdBefore.UTC())
+	return err
+}
+
+func (p *PostgresUserRepository) ExpireDataExports(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "UPDATE data_exports SET status = $1 WHERE status = $2 AND expires_at < $3 RETURNING id",
+		models2.DataExportExpired, models2.DataExportCompleted, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var ids = make([]string, 0)
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (p *PostgresUserRepository) queryDataExport(ctx context.Context, query string, args ...interface{}) (*models2.DataExport, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var export = models2.DataExport{}
+	for rows.Next() {
+		var completedAt, expiresAt sql.NullTime
+		err := rows.Scan(&export.Id, &export.UserId, &export.Status, &export.Error, &export.CreatedAt, &completedAt, &expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if completedAt.Valid {
+			export.CompletedAt = &completedAt.Time
+		}
+		if expiresAt.Valid {
+			export.ExpiresAt = &expiresAt.Time
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"log"
+	"strings"
+)
+
+// Follow reports whether the follow is new.
+func (p *PostgresUserRepository) Follow(ctx context.Context, followerId string, followeeId string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", followerId, followeeId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (p *PostgresUserRepository) Unfollow(ctx context.Context, followerId string, followeeId string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2", followerId, followeeId)
+	return err
+}
+
+func (p *PostgresUserRepository) GetFollowers(ctx context.Context, viewerId string, userId string, after *models2.Cursor, limit int) ([]models2.Follow, error) {
+	return p.queryFollows(ctx, "f.follower_id", "f.followee_id", viewerId, userId, after, limit)
+}
+
+func (p *PostgresUserRepository) GetFollowing(ctx context.Context, viewerId string, userId string, after *models2.Cursor, limit int) ([]models2.Follow, error) {
+	return p.queryFollows(ctx, "f.followee_id", "f.follower_id", viewerId, userId, after, limit)
+}
+
+// queryFollows lists the users on the other side of userId's follows, newest
+// first, joining the profile through profileColumn. Users hidden from
+// viewerId by blocks and mutes are left out.
+func (p *PostgresUserRepository) queryFollows(ctx context.Context, profileColumn string, userColumn string, viewerId string, userId string, after *models2.Cursor, limit int) ([]models2.Follow, error) {
+	var conditions []string
+	var args []interface{}
+	if viewerId != "" {
+		conditions = append(conditions, hiddenAuthorCondition)
+		args = append(args, viewerId)
+	}
+	args = append(args, userId)
+	conditions = append(conditions, userColumn+" = "+placeholder(len(args)))
+	if after != nil {
+		args = append(args, after.CreatedAt.UTC(), after.Id)
+		conditions = append(conditions, "(f.created_at, "+profileColumn+") < ("+placeholder(len(args)-1)+", "+placeholder(len(args))+")")
+	}
+	args = append(args, limit)
+	query := "SELECT u.id, COALESCE(u.handle, ''), u.display_name, u.bio, u.avatar_url, u.created_at, f.created_at FROM follows f JOIN users u ON u.id = " + profileColumn +
+		" WHERE " + strings.Join(conditions, " AND ") + " ORDER BY f.created_at DESC, " + profileColumn + " DESC LIMIT " + placeholder(len(args))
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var follows = make([]models2.Follow, 0, limit)
+	for rows.Next() {
+		var follow = models2.Follow{}
+		err := rows.Scan(&follow.Id, &follow.Handle, &follow.DisplayName, &follow.Bio, &follow.AvatarUrl, &follow.CreatedAt, &follow.FollowedAt)
+		if err != nil {
+			return nil, err
+		}
+		follows = append(follows, follow)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return follows, nil
+}
+
+func (p *PostgresUserRepository) GetFollowerIds(ctx context.Context, userId string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT follower_id FROM follows WHERE followee_id = $1", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var ids = make([]string, 0)
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetTimeline returns the posts of the users userId follows, newest first,
+// leaving out muted and blocked authors.
+func (p *PostgresUserRepository) GetTimeline(ctx context.Context, userId string, after *models2.Cursor, limit int) ([]models2.Post, error) {
+	query := "SELECT " + postColumns + " FROM " + postTables + " JOIN follows f ON f.followee_id = p.user_id AND f.follower_id = $1"
+	query += " WHERE " + hiddenAuthorCondition
+	args := []interface{}{userId}
+	if after != nil {
+		query += " AND (p.created_at, p.id) < ($2, $3)"
+		args = append(args, after.CreatedAt.UTC(), after.Id)
+	}
+	query += " ORDER BY p.created_at DESC, p.id DESC LIMIT " + placeholder(len(args)+1)
+	args = append(args, limit)
+	return p.queryPosts(ctx, query, args...)
+}
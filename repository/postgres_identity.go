@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	models2 "go-rest-websockets/models"
+	"log"
+)
+
+func (p *PostgresUserRepository) GetIdentity(ctx context.Context, issuer string, subject string) (*models2.Identity, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT issuer, subject, user_id, email, created_at FROM identities WHERE issuer = $1 AND subject = $2", issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var identity = models2.Identity{}
+	for rows.Next() {
+		err := rows.Scan(&identity.Issuer, &identity.Subject, &identity.UserId, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+func (p *PostgresUserRepository) GetIdentitiesByUser(ctx context.Context, userId string) ([]models2.Identity, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT issuer, subject, user_id, email, created_at FROM identities WHERE user_id = $1 ORDER BY created_at", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var identities = make([]models2.Identity, 0)
+	for rows.Next() {
+		var identity = models2.Identity{}
+		err := rows.Scan(&identity.Issuer, &identity.Subject, &identity.UserId, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (p *PostgresUserRepository) InsertIdentity(ctx context.Context, identity *models2.Identity) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO identities (issuer, subject, user_id, email) VALUES ($1, $2, $3, $4)", identity.Issuer, identity.Subject, identity.UserId, identity.Email)
+	return err
+}
+
+// InsertUserWithIdentity creates an account for a first external login, so a
+// failure cannot leave a user without the identity that signs them in.
+func (p *PostgresUserRepository) InsertUserWithIdentity(ctx context.Context, user *models2.User, identity *models2.Identity) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO users (id, email, password, email_verified) VALUES ($1, $2, $3, $4)", user.Id, user.Email, user.Password, user.EmailVerified)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO identities (issuer, subject, user_id, email) VALUES ($1, $2, $3, $4)", identity.Issuer, identity.Subject, user.Id, identity.Email)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
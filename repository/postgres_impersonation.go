@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"log"
+)
+
+func (p *PostgresUserRepository) InsertImpersonationAuditEntry(ctx context.Context, entry *models2.ImpersonationAuditEntry) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO impersonation_audit (actor_id, user_id, token_id, method, path, status, ip) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		entry.ActorId, entry.UserId, entry.TokenId, entry.Method, entry.Path, entry.Status, entry.Ip)
+	return err
+}
+
+func (p *PostgresUserRepository) GetImpersonationAuditByUser(ctx context.Context, userId string, limit int) ([]models2.ImpersonationAuditEntry, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT id, actor_id, user_id, token_id, method, path, status, ip, created_at FROM impersonation_audit WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2", userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var entries = make([]models2.ImpersonationAuditEntry, 0)
+	for rows.Next() {
+		var entry = models2.ImpersonationAuditEntry{}
+		err := rows.Scan(&entry.Id, &entry.ActorId, &entry.UserId, &entry.TokenId, &entry.Method, &entry.Path, &entry.Status, &entry.Ip, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/segmentio/ksuid"
+	models2 "go-rest-websockets/models"
+	"log"
+	"time"
+)
+
+// directKey identifies the one conversation two users share, whichever of
+// them starts it.
+func directKey(userId string, otherUserId string) string {
+	if userId > otherUserId {
+		userId, otherUserId = otherUserId, userId
+	}
+	return userId + ":" + otherUserId
+}
+
+func (p *PostgresUserRepository) GetOrCreateDirectConversation(ctx context.Context, userId string, otherUserId string) (*models2.Conversation, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	key := directKey(userId, otherUserId)
+	_, err = tx.ExecContext(ctx, "INSERT INTO conversations (id, direct_key) VALUES ($1, $2) ON CONFLICT (direct_key) DO NOTHING", id.String(), key)
+	if err != nil {
+		return nil, err
+	}
+	var conversationId string
+	err = tx.QueryRowContext(ctx, "SELECT id FROM conversations WHERE direct_key = $1", key).Scan(&conversationId)
+	if err != nil {
+		return nil, err
+	}
+	for _, participantId := range []string{userId, otherUserId} {
+		_, err = tx.ExecContext(ctx, "INSERT INTO conversation_participants (conversation_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", conversationId, participantId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return p.GetConversation(ctx, conversationId, userId)
+}
+
+const conversationColumns = `c.id, c.created_at, c.last_message_at,
+	(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id AND m.sender_id <> me.user_id AND (me.last_read_at IS NULL OR m.created_at > me.last_read_at))`
+
+func (p *PostgresUserRepository) GetConversation(ctx context.Context, id string, userId string) (*models2.Conversation, error) {
+	conversations, err := p.queryConversations(ctx, "SELECT "+conversationColumns+" FROM conversations c JOIN conversation_participants me ON me.conversation_id = c.id AND me.user_id = $1 WHERE c.id = $2", userId, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return &models2.Conversation{}, nil
+	}
+	return &conversations[0], nil
+}
+
+// GetConversations lists the conversations of userId, most recently active first.
+func (p *PostgresUserRepository) GetConversations(ctx context.Context, userId string, after *models2.Cursor, limit int) ([]models2.Conversation, error) {
+	query := "SELECT " + conversationColumns + " FROM conversations c JOIN conversation_participants me ON me.conversation_id = c.id AND me.user_id = $1"
+	args := []interface{}{userId}
+	if after != nil {
+		query += " WHERE (c.last_message_at, c.id) < ($2, $3)"
+		args = append(args, after.CreatedAt.UTC(), after.Id)
+	}
+	query += " ORDER BY c.last_message_at DESC, c.id DESC LIMIT " + placeholder(len(args)+1)
+	args = append(args, limit)
+	return p.queryConversations(ctx, query, args...)
+}
+
+func (p *PostgresUserRepository) queryConversations(ctx context.Context, query string, args ...interface{}) ([]models2.Conversation, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var conversations = make([]models2.Conversation, 0)
+	for rows.Next() {
+		var conversation = models2.Conversation{Participants: make([]models2.Participant, 0)}
+		err := rows.Scan(&conversation.Id, &conversation.CreatedAt, &conversation.LastMessageAt, &conversation.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conversations) == 0 {
+		return conversations, nil
+	}
+	return conversations, p.loadConversationDetails(ctx, conversations)
+}
+
+// loadConversationDetails fills in the participants and last message of the
+// conversations with one query each.
+func (p *PostgresUserRepository) loadConversationDetails(ctx context.Context, conversations []models2.Conversation) error {
+	ids := make([]string, 0, len(conversations))
+	byId := make(map[string]*models2.Conversation, len(conversations))
+	for i := range conversations {
+		ids = append(ids, conversations[i].Id)
+		byId[conversations[i].Id] = &conversations[i]
+	}
+
+	rows, err := p.db.QueryContext(ctx, "SELECT cp.conversation_id, cp.last_read_at, u.id, COALESCE(u.handle, ''), u.display_name, u.avatar_url FROM conversation_participants cp JOIN users u ON u.id = cp.user_id WHERE cp.conversation_id = ANY($1) ORDER BY cp.joined_at", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+	for rows.Next() {
+		var conversationId string
+		var participant = models2.Participant{}
+		var lastReadAt sql.NullTime
+		err := rows.Scan(&conversationId, &lastReadAt, &participant.Id, &participant.Handle, &participant.DisplayName, &participant.AvatarUrl)
+		if err != nil {
+			return err
+		}
+		if lastReadAt.Valid {
+			participant.LastReadAt = &lastReadAt.Time
+		}
+		conversation := byId[conversationId]
+		conversation.Participants = append(conversation.Participants, participant)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	messages, err := p.queryMessages(ctx, "SELECT DISTINCT ON (conversation_id) id, conversation_id, sender_id, body, created_at FROM messages WHERE conversation_id = ANY($1) ORDER BY conversation_id, created_at DESC, id DESC", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		byId[messages[i].ConversationId].LastMessage = &messages[i]
+	}
+	return nil
+}
+
+func (p *PostgresUserRepository) InsertMessage(ctx context.Context, message *models2.Message) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO messages (id, conversation_id, sender_id, body) VALUES ($1, $2, $3, $4) RETURNING created_at",
+		message.Id, message.ConversationId, message.SenderId, message.Body).Scan(&message.CreatedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE conversations SET last_message_at = $1 WHERE id = $2", message.CreatedAt, message.ConversationId)
+	if err != nil {
+		return err
+	}
+	// sending a message implies having read the conversation up to it
+	_, err = tx.ExecContext(ctx, "UPDATE conversation_participants SET last_read_at = $1 WHERE conversation_id = $2 AND user_id = $3", message.CreatedAt, message.ConversationId, message.SenderId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMessages pages through the history of a conversation, newest first.
+func (p *PostgresUserRepository) GetMessages(ctx context.Context, conversationId string, after *models2.Cursor, limit int) ([]models2.Message, error) {
+	query := "SELECT id, conversation_id, sender_id, body, created_at FROM messages WHERE conversation_id = $1"
+	args := []interface{}{conversationId}
+	if after != nil {
+		query += " AND (created_at, id) < ($2, $3)"
+		args = append(args, after.CreatedAt.UTC(), after.Id)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + placeholder(len(args)+1)
+	args = append(args, limit)
+	return p.queryMessages(ctx, query, args...)
+}
+
+func (p *PostgresUserRepository) ForEachMessageByUser(ctx context.Context, userId string, fn func(message models2.Message) error) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT m.id, m.conversation_id, m.sender_id, m.body, m.created_at FROM messages m JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = $1 ORDER BY m.conversation_id, m.created_at", userId)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var message = models2.Message{}
+		err := rows.Scan(&message.Id, &message.ConversationId, &message.SenderId, &message.Body, &message.CreatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (p *PostgresUserRepository) queryMessages(ctx context.Context, query string, args ...interface{}) ([]models2.Message, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var messages = make([]models2.Message, 0)
+	for rows.Next() {
+		var message = models2.Message{}
+		err := rows.Scan(&message.Id, &message.ConversationId, &message.SenderId, &message.Body, &message.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (p *PostgresUserRepository) MarkConversationRead(ctx context.Context, conversationId string, userId string) (time.Time, error) {
+	var readAt time.Time
+	err := p.db.QueryRowContext(ctx, "UPDATE conversation_participants SET last_read_at = NOW() WHERE conversation_id = $1 AND user_id = $2 RETURNING last_read_at", conversationId, userId).Scan(&readAt)
+	return readAt, err
+}
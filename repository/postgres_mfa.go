@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+func (p *PostgresUserRepository) SetUserTotpSecret(ctx context.Context, userId string, secret string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET totp_secret = $1, totp_last_counter = NULL WHERE id = $2 AND totp_enabled = FALSE", secret, userId)
+	return err
+}
+
+func (p *PostgresUserRepository) UseTotpCounter(ctx context.Context, userId string, counter int64) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "UPDATE users SET totp_last_counter = $1 WHERE id = $2 AND (totp_last_counter IS NULL OR totp_last_counter < $1)", counter, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (p *PostgresUserRepository) EnableUserTotp(ctx context.Context, userId string, recoveryCodeHashes []string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction %v", err)
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET totp_enabled = TRUE WHERE id = $1", userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userId, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresUserRepository) DisableUserTotp(ctx context.Context, userId string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET totp_enabled = FALSE, totp_secret = NULL WHERE id = $1", userId)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	return err
+}
+
+func (p *PostgresUserRepository) ConsumeRecoveryCode(ctx context.Context, userId string, codeHash string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL", userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
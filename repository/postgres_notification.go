@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	models2 "go-rest-websockets/models"
+	"log"
+)
+
+func (p *PostgresUserRepository) InsertNotification(ctx context.Context, notification *models2.Notification) error {
+	var entityId interface{}
+	if notification.EntityId != "" {
+		entityId = notification.EntityId
+	}
+	return p.db.QueryRowContext(ctx, "INSERT INTO notifications (id, user_id, actor_id, type, entity_id) VALUES ($1, $2, $3, $4, $5) RETURNING created_at",
+		notification.Id, notification.UserId, notification.Actor.Id, notification.Type, entityId).Scan(&notification.CreatedAt)
+}
+
+func (p *PostgresUserRepository) GetNotifications(ctx context.Context, userId string, unreadOnly bool, after *models2.Cursor, limit int) ([]models2.Notification, error) {
+	query := "SELECT n.id, n.user_id, n.type, COALESCE(n.entity_id, ''), n.read_at, n.created_at, u.id, COALESCE(u.handle, ''), u.display_name, u.avatar_url FROM notifications n JOIN users u ON u.id = n.actor_id WHERE n.user_id = $1"
+	args := []interface{}{userId}
+	if unreadOnly {
+		query += " AND n.read_at IS NULL"
+	}
+	if after != nil {
+		query += " AND (n.created_at, n.id) < ($2, $3)"
+		args = append(args, after.CreatedAt.UTC(), after.Id)
+	}
+	query += " ORDER BY n.created_at DESC, n.id DESC LIMIT " + placeholder(len(args)+1)
+	args = append(args, limit)
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var notifications = make([]models2.Notification, 0, limit)
+	for rows.Next() {
+		var notification = models2.Notification{Actor: &models2.Author{}}
+		var readAt sql.NullTime
+		err := rows.Scan(&notification.Id, &notification.UserId, &notification.Type, &notification.EntityId, &readAt, &notification.CreatedAt,
+			&notification.Actor.Id, &notification.Actor.Handle, &notification.Actor.DisplayName, &notification.Actor.AvatarUrl)
+		if err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			notification.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (p *PostgresUserRepository) ForEachNotificationByUser(ctx context.Context, userId string, fn func(notification models2.Notification) error) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT n.id, n.user_id, n.type, COALESCE(n.entity_id, ''), n.read_at, n.created_at, u.id, COALESCE(u.handle, ''), u.display_name, u.avatar_url FROM notifications n JOIN users u ON u.id = n.actor_id WHERE n.user_id = $1 ORDER BY n.created_at", userId)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var notification = models2.Notification{Actor: &models2.Author{}}
+		var readAt sql.NullTime
+		err := rows.Scan(&notification.Id, &notification.UserId, &notification.Type, &notification.EntityId, &readAt, &notification.CreatedAt,
+			&notification.Actor.Id, &notification.Actor.Handle, &notification.Actor.DisplayName, &notification.Actor.AvatarUrl)
+		if err != nil {
+			return err
+		}
+		if readAt.Valid {
+			notification.ReadAt = &readAt.Time
+		}
+		err = fn(notification)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (p *PostgresUserRepository) CountUnreadNotifications(ctx context.Context, userId string) (int, error) {
+	var count int
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userId).Scan(&count)
+	return count, err
+}
+
+func (p *PostgresUserRepository) MarkNotificationsRead(ctx context.Context, userId string, ids []string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND id = ANY($2) AND read_at IS NULL", userId, pq.Array(ids))
+	return err
+}
+
+func (p *PostgresUserRepository) MarkAllNotificationsRead(ctx context.Context, userId string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL", userId)
+	return err
+}
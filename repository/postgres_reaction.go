@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"github.com/lib/pq"
+	models2 "go-rest-websockets/models"
+	"log"
+)
+
+// AddReaction reports whether the reaction is new, adding it again is a no-op.
+func (p *PostgresUserRepository) AddReaction(ctx context.Context, postId string, userId string, reaction string) (bool, error) {
+	result, err := p.db.ExecContext(ctx, "INSERT INTO post_reactions (post_id, user_id, reaction) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", postId, userId, reaction)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+func (p *PostgresUserRepository) RemoveReaction(ctx context.Context, postId string, userId string, reaction string) error {
+	_, err := p.db.ExecContext(ctx, "DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND reaction = $3", postId, userId, reaction)
+	return err
+}
+
+// GetReactionSummaries returns a summary for each of the posts, including
+// those without reactions. Viewer lists stay empty when viewerId is empty.
+func (p *PostgresUserRepository) GetReactionSummaries(ctx context.Context, viewerId string, postIds []string) (map[string]*models2.ReactionSummary, error) {
+	summaries := make(map[string]*models2.ReactionSummary, len(postIds))
+	for _, postId := range postIds {
+		summaries[postId] = models2.NewReactionSummary()
+	}
+	if len(postIds) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, "SELECT post_id, reaction, COUNT(*), COALESCE(BOOL_OR(user_id = $1), FALSE) FROM post_reactions WHERE post_id = ANY($2) GROUP BY post_id, reaction ORDER BY post_id, reaction", viewerId, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var postId, reaction string
+		var count int
+		var reacted bool
+		err := rows.Scan(&postId, &reaction, &count, &reacted)
+		if err != nil {
+			return nil, err
+		}
+		summary := summaries[postId]
+		summary.Counts[reaction] = count
+		if reacted {
+			summary.Viewer = append(summary.Viewer, reaction)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+func (p *PostgresUserRepository) ForEachReactionByUser(ctx context.Context, userId string, fn func(reaction models2.Reaction) error) error {
+	rows, err := p.db.QueryContext(ctx, "SELECT post_id, reaction, created_at FROM post_reactions WHERE user_id = $1 ORDER BY created_at", userId)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var reaction = models2.Reaction{}
+		err := rows.Scan(&reaction.PostId, &reaction.Reaction, &reaction.CreatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(reaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"log"
+	"time"
+)
+
+func (p *PostgresUserRepository) RevokeToken(ctx context.Context, token *models2.RevokedToken) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO revoked_tokens (token_id, user_id, expires_at) VALUES ($1, $2, $3) ON CONFLICT (token_id) DO NOTHING",
+		token.TokenId, token.UserId, token.ExpiresAt.UTC())
+	return err
+}
+
+func (p *PostgresUserRepository) RevokeUserTokens(ctx context.Context, revocation *models2.UserTokenRevocation) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO user_token_revocations (user_id, revoked_before) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before",
+		revocation.UserId, revocation.RevokedBefore.UTC())
+	return err
+}
+
+func (p *PostgresUserRepository) GetRevokedTokens(ctx context.Context, expiringAfter time.Time) ([]models2.RevokedToken, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT token_id, user_id, expires_at FROM revoked_tokens WHERE expires_at > $1", expiringAfter.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var tokens = make([]models2.RevokedToken, 0)
+	for rows.Next() {
+		var token = models2.RevokedToken{}
+		err := rows.Scan(&token.TokenId, &token.UserId, &token.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (p *PostgresUserRepository) GetUserTokenRevocations(ctx context.Context) ([]models2.UserTokenRevocation, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT user_id, revoked_before FROM user_token_revocations")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var revocations = make([]models2.UserTokenRevocation, 0)
+	for rows.Next() {
+		var revocation = models2.UserTokenRevocation{}
+		err := rows.Scan(&revocation.UserId, &revocation.RevokedBefore)
+		if err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, revocation)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return revocations, nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"log"
+	"time"
+)
+
+func (p *PostgresUserRepository) InsertSession(ctx context.Context, session *models2.Session) error {
+	return p.db.QueryRowContext(ctx, "INSERT INTO sessions (id, user_id, token_id, device, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at, last_seen_at",
+		session.Id, session.UserId, session.TokenId, session.Device, session.UserAgent, session.Ip, session.ExpiresAt.UTC()).Scan(&session.CreatedAt, &session.LastSeenAt)
+}
+
+func (p *PostgresUserRepository) GetSession(ctx context.Context, id string, userId string) (*models2.Session, error) {
+	sessions, err := p.querySessions(ctx, "SELECT id, user_id, token_id, device, user_agent, ip, created_at, last_seen_at, expires_at FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return &models2.Session{}, nil
+	}
+	return &sessions[0], nil
+}
+
+func (p *PostgresUserRepository) GetActiveSessions(ctx context.Context, userId string) ([]models2.Session, error) {
+	return p.querySessions(ctx, "SELECT id, user_id, token_id, device, user_agent, ip, created_at, last_seen_at, expires_at FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW() ORDER BY last_seen_at DESC", userId)
+}
+
+func (p *PostgresUserRepository) GetSessionsByUser(ctx context.Context, userId string) ([]models2.Session, error) {
+	return p.querySessions(ctx, "SELECT id, user_id, token_id, device, user_agent, ip, created_at, last_seen_at, expires_at FROM sessions WHERE user_id = $1 ORDER BY created_at", userId)
+}
+
+func (p *PostgresUserRepository) querySessions(ctx context.Context, query string, args ...interface{}) ([]models2.Session, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Fatalf("error closing rows reader %v", err)
+		}
+	}()
+
+	var sessions = make([]models2.Session, 0)
+	for rows.Next() {
+		var session = models2.Session{}
+		err := rows.Scan(&session.Id, &session.UserId, &session.TokenId, &session.Device, &session.UserAgent, &session.Ip, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (p *PostgresUserRepository) TouchSession(ctx context.Context, id string, seenAt time.Time) error {
+	// only write when the stored value is stale so busy sessions do not update on every request
+	_, err := p.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = $2 WHERE id = $1 AND last_seen_at < $2 - INTERVAL '1 minute'", id, seenAt.UTC())
+	return err
+}
+
+func (p *PostgresUserRepository) RevokeSession(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	return err
+}
+
+func (p *PostgresUserRepository) RevokeUserSessions(ctx context.Context, userId string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userId)
+	return err
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	models2 "go-rest-websockets/models"
+	"time"
+)
+
+func (p *PostgresUserRepository) InsertUserToken(ctx context.Context, token *models2.UserToken) error {
+	_, err := p.db.ExecContext(ctx, "INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at, data) VALUES ($1, $2, $3, $4, $5, $6)",
+		token.Id, token.UserId, token.Purpose, token.TokenHash, token.ExpiresAt.UTC(), sql.NullString{String: token.Data, Valid: token.Data != ""})
+	return err
+}
+
+// ConsumeUserToken marks the token as used and returns it, or returns an empty
+// token when it does not exist, expired or was already used.
+func (p *PostgresUserRepository) ConsumeUserToken(ctx context.Context, purpose string, tokenHash string) (*models2.UserToken, error) {
+	var token = models2.UserToken{}
+	err := p.db.QueryRowContext(ctx, "UPDATE user_tokens SET used_at = NOW() WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3 RETURNING id, user_id, purpose, token_hash, expires_at, COALESCE(data, '')",
+		tokenHash, purpose, time.Now().UTC()).Scan(&token.Id, &token.UserId, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.Data)
+	if err == sql.ErrNoRows {
+		return &models2.UserToken{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (p *PostgresUserRepository) InvalidateUserTokens(ctx context.Context, userId string, purpose string) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL", userId, purpose)
+	return err
+}
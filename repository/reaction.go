@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type ReactionRepository interface {
+	AddReaction(ctx context.Context, postId string, userId string, reaction string) (bool, error)
+	RemoveReaction(ctx context.Context, postId string, userId string, reaction string) error
+	GetReactionSummaries(ctx context.Context, viewerId string, postIds []string) (map[string]*models2.ReactionSummary, error)
+	ForEachReactionByUser(ctx context.Context, userId string, fn func(reaction models2.Reaction) error) error
+}
@@ -2,17 +2,39 @@ package repository
 
 import (
 	"context"
+	"errors"
 	models2 "go-rest-websockets/models"
 )
 
+var (
+	ErrHandleTaken     = errors.New("handle is already taken")
+	ErrAlreadyReposted = errors.New("post is already reposted")
+)
+
 type Repository interface {
 	InsertUser(ctx context.Context, user *models2.User) error
 	GetUserById(ctx context.Context, id string) (*models2.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models2.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (*models2.User, error)
+	UpdateUserProfile(ctx context.Context, user *models2.User) error
+	UpdateUserPassword(ctx context.Context, userId string, password string) error
+	SetUserEmailVerified(ctx context.Context, userId string) error
+	UpdateUserEmail(ctx context.Context, userId string, email string) error
+	DeleteUser(ctx context.Context, userId string) error
+	AnonymizeUser(ctx context.Context, userId string, placeholderEmail string) error
+	GetUserRoles(ctx context.Context, userId string) ([]string, error)
+	AddUserRole(ctx context.Context, userId string, role string) error
+	HasUserWithRole(ctx context.Context, role string) (bool, error)
+	RemoveUserRole(ctx context.Context, userId string, role string) error
 	InsertPost(ctx context.Context, post *models2.Post) error
 	GetPostById(ctx context.Context, id string) (*models2.Post, error)
-	UpdatePost(ctx context.Context, post *models2.Post) error
-	DeletePost(ctx context.Context, post *models2.Post) error
-	GetPaginatedPosts(ctx context.Context, size, page int) ([]models2.Post, error)
+	UpdatePost(ctx context.Context, post *models2.Post) (bool, error)
+	DeletePost(ctx context.Context, post *models2.Post) (bool, error)
+	DeleteAnyPost(ctx context.Context, id string) (bool, error)
+	GetRepost(ctx context.Context, userId string, originalPostId string) (*models2.Post, error)
+	DeleteRepost(ctx context.Context, userId string, originalPostId string) error
+	GetPaginatedPosts(ctx context.Context, viewerId string, size, page int) ([]models2.Post, error)
+	CountPostsByUser(ctx context.Context, userId string) (int, error)
+	ForEachPostByUser(ctx context.Context, userId string, fn func(post models2.Post) error) error
 	Close() error
 }
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"time"
+)
+
+type RevocationRepository interface {
+	RevokeToken(ctx context.Context, token *models2.RevokedToken) error
+	RevokeUserTokens(ctx context.Context, revocation *models2.UserTokenRevocation) error
+	GetRevokedTokens(ctx context.Context, expiringAfter time.Time) ([]models2.RevokedToken, error)
+	GetUserTokenRevocations(ctx context.Context) ([]models2.UserTokenRevocation, error)
+}
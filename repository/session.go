@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+	"time"
+)
+
+type SessionRepository interface {
+	InsertSession(ctx context.Context, session *models2.Session) error
+	GetSession(ctx context.Context, id string, userId string) (*models2.Session, error)
+	GetActiveSessions(ctx context.Context, userId string) ([]models2.Session, error)
+	// GetSessionsByUser returns every recorded session, ended ones included.
+	GetSessionsByUser(ctx context.Context, userId string) ([]models2.Session, error)
+	TouchSession(ctx context.Context, id string, seenAt time.Time) error
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userId string) error
+}
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	models2 "go-rest-websockets/models"
+)
+
+type UserTokenRepository interface {
+	InsertUserToken(ctx context.Context, token *models2.UserToken) error
+	ConsumeUserToken(ctx context.Context, purpose string, tokenHash string) (*models2.UserToken, error)
+	InvalidateUserTokens(ctx context.Context, userId string, purpose string) error
+}
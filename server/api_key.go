@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	ApiKeyPrefix = "ak_"
+
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+)
+
+var ApiKeyScopes = []string{ScopePostsRead, ScopePostsWrite}
+
+func IsKnownScope(scope string) bool {
+	for _, known := range ApiKeyScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func GenerateApiKey() (string, string, error) {
+	return GenerateSecret(ApiKeyPrefix)
+}
+
+func (a Authorization) authenticateApiKey(ctx context.Context, credential string) (*Principal, error) {
+	key, err := a.apiKeys.GetApiKeyByHash(ctx, HashSecret(credential))
+	if err != nil {
+		return nil, err
+	}
+	if key.Id == "" {
+		return nil, fmt.Errorf("api key is not valid")
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		return nil, fmt.Errorf("api key has expired")
+	}
+	err = a.apiKeys.TouchApiKey(ctx, key.Id, now)
+	if err != nil {
+		log.Printf("error updating api key last use %v", err)
+	}
+
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &Principal{
+		UserId:        key.UserId,
+		ApiKeyId:      key.Id,
+		Scopes:        scopes,
+		EmailVerified: key.OwnerEmailVerified,
+	}, nil
+}
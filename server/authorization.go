@@ -1,33 +1,191 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
 	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"log"
+	"strings"
 	"time"
 )
 
-type Authorization struct{}
+const (
+	TokenLifetime         = time.Hour
+	MFAChallengeLifetime  = 5 * time.Minute
+	ImpersonationLifetime = 15 * time.Minute
+	AudienceMFAChallenge  = "mfa"
+	AudienceOIDCLogin     = "oidc-login"
+)
+
+type Authorization struct {
+	keys        *KeySet
+	revocations *RevocationStore
+	apiKeys     repository.ApiKeyRepository
+	sessions    repository.SessionRepository
+}
+
+func NewAuthorization(keys *KeySet, revocations *RevocationStore, apiKeys repository.ApiKeyRepository, sessions repository.SessionRepository) Authorization {
+	return Authorization{keys: keys, revocations: revocations, apiKeys: apiKeys, sessions: sessions}
+}
+
+// Authenticate accepts either a session token or a personal API key.
+func (a Authorization) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	if strings.HasPrefix(credential, ApiKeyPrefix) {
+		return a.authenticateApiKey(ctx, credential)
+	}
+	claims, err := a.ParseAndVerifyToken(credential)
+	if err != nil {
+		return nil, err
+	}
+	if claims.SessionId != "" {
+		err = a.sessions.TouchSession(ctx, claims.SessionId, time.Now())
+		if err != nil {
+			log.Printf("error updating session last seen %v", err)
+		}
+	}
+	return a.Principal(claims), nil
+}
 
-func NewAuthorization() Authorization {
-	return Authorization{}
+// StartSession records the login described by session and signs the token
+// backing it. Id, UserId, TokenId and ExpiresAt are filled in.
+func (a Authorization) StartSession(ctx context.Context, user *models.User, session *models.Session) (string, error) {
+	sessionId, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	tokenId, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	session.Id = sessionId.String()
+	session.UserId = user.Id
+	session.TokenId = tokenId.String()
+	session.ExpiresAt = now.Add(TokenLifetime)
+	err = a.sessions.InsertSession(ctx, session)
+	if err != nil {
+		return "", err
+	}
+
+	claims := models.AppClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        session.TokenId,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+		},
+		UserId:        user.Id,
+		Roles:         user.Roles,
+		EmailVerified: user.EmailVerified,
+		SessionId:     session.Id,
+		IssuedAtNano:  now.UnixNano(),
+	}
+	return a.sign(claims)
 }
 
-func (a Authorization) SignToken(secretKey string, userId string) (string, error) {
+// SignMFAChallenge issues the short lived token handed out after a correct
+// password when the second factor is still missing. Its audience keeps it from
+// being accepted as a session token.
+func (a Authorization) SignMFAChallenge(userId string) (string, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
 	claims := models.AppClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			Id:        id.String(),
+			Audience:  AudienceMFAChallenge,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(MFAChallengeLifetime).Unix(),
+		},
+		UserId:       userId,
+		IssuedAtNano: now.UnixNano(),
+	}
+	return a.sign(claims)
+}
+
+// SignImpersonationToken lets actor act as user for a short time. The token
+// has no session, so it never shows up in the user's session list.
+func (a Authorization) SignImpersonationToken(actor *Principal, user *models.User, readOnly bool) (string, *models.AppClaims, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	claims := &models.AppClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        id.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ImpersonationLifetime).Unix(),
+		},
+		UserId:        user.Id,
+		Roles:         user.Roles,
+		EmailVerified: user.EmailVerified,
+		Actor:         &models.Actor{UserId: actor.UserId, ReadOnly: readOnly},
+		IssuedAtNano:  now.UnixNano(),
+	}
+	token, err := a.sign(*claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+type oidcLoginClaims struct {
+	jwt.StandardClaims
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// SignOIDCLogin turns a started login into a token for the login cookie, so
+// pending logins take no server memory and work across instances.
+func (a Authorization) SignOIDCLogin(login *OIDCLogin) (string, error) {
+	now := time.Now()
+	claims := oidcLoginClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        login.State,
+			Audience:  AudienceOIDCLogin,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(OIDCLoginLifetime).Unix(),
 		},
-		UserId: userId,
+		Nonce:    login.Nonce,
+		Verifier: login.Verifier,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	return a.sign(claims)
 }
 
-func (a Authorization) ParseAndVerifyToken(secretKey string, tokenString string) (*models.AppClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
+func (a Authorization) ParseOIDCLogin(tokenString string) (*OIDCLogin, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &oidcLoginClaims{}, a.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*oidcLoginClaims)
+	if !ok || !token.Valid || claims.Audience != AudienceOIDCLogin || claims.Id == "" {
+		return nil, fmt.Errorf("login is not valid")
+	}
+	return &OIDCLogin{State: claims.Id, Nonce: claims.Nonce, Verifier: claims.Verifier}, nil
+}
+
+func (a Authorization) sign(claims jwt.Claims) (string, error) {
+	key := a.keys.SigningKey()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Id
+	return token.SignedString(key.Private)
+}
+
+func (a Authorization) ParseAndVerifyToken(tokenString string) (*models.AppClaims, error) {
+	return a.parse(tokenString, "")
+}
+
+func (a Authorization) ParseAndVerifyMFAChallenge(tokenString string) (*models.AppClaims, error) {
+	return a.parse(tokenString, AudienceMFAChallenge)
+}
+
+func (a Authorization) parse(tokenString string, audience string) (*models.AppClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, a.verificationKey)
 	if err != nil {
 		return nil, err
 	}
@@ -37,5 +195,97 @@ func (a Authorization) ParseAndVerifyToken(secretKey string, tokenString string)
 		return nil, fmt.Errorf("token is not valid")
 	}
 
+	if claims.Id == "" || claims.Audience != audience {
+		return nil, fmt.Errorf("token is not valid")
+	}
+
+	if a.revocations.IsRevoked(claims) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
 	return claims, nil
 }
+
+func (a Authorization) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyId, _ := token.Header["kid"].(string)
+	key, ok := a.keys.VerificationKey(keyId)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", keyId)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Private.Public(), nil
+}
+
+func (a Authorization) Principal(claims *models.AppClaims) *Principal {
+	principal := &Principal{
+		UserId:        claims.UserId,
+		Roles:         claims.Roles,
+		TokenId:       claims.Id,
+		SessionId:     claims.SessionId,
+		ExpiresAt:     time.Unix(claims.ExpiresAt, 0),
+		EmailVerified: claims.EmailVerified,
+	}
+	if claims.Actor != nil {
+		principal.ActorId = claims.Actor.UserId
+		principal.ReadOnly = claims.Actor.ReadOnly
+	}
+	return principal
+}
+
+func (a Authorization) JWKS() JSONWebKeySet {
+	return a.keys.JWKS()
+}
+
+func (a Authorization) RevokeToken(ctx context.Context, principal *Principal) error {
+	if principal.SessionId != "" {
+		err := a.sessions.RevokeSession(ctx, principal.SessionId)
+		if err != nil {
+			return err
+		}
+	}
+	return a.revocations.RevokeToken(ctx, principal.TokenId, principal.UserId, principal.ExpiresAt)
+}
+
+// RevokeSession ends the session and revokes its token, which also closes the
+// websocket connections opened with it.
+func (a Authorization) RevokeSession(ctx context.Context, session *models.Session) error {
+	err := a.sessions.RevokeSession(ctx, session.Id)
+	if err != nil {
+		return err
+	}
+	return a.revocations.RevokeToken(ctx, session.TokenId, session.UserId, session.ExpiresAt)
+}
+
+func (a Authorization) RevokeUserTokens(ctx context.Context, userId string) error {
+	err := a.sessions.RevokeUserSessions(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return a.revocations.RevokeUserTokens(ctx, userId)
+}
+
+// RevokeApiKey revokes one of the user's API keys and closes the websocket
+// connections opened with it.
+func (a Authorization) RevokeApiKey(ctx context.Context, id string, userId string) (bool, error) {
+	revoked, err := a.apiKeys.RevokeApiKey(ctx, id, userId)
+	if err != nil || !revoked {
+		return revoked, err
+	}
+	a.revocations.hub.CloseTokenSessions(id)
+	return true, nil
+}
+
+// RevokeUserCredentials revokes the tokens and the API keys of the user, for
+// when the account may have been taken over.
+func (a Authorization) RevokeUserCredentials(ctx context.Context, userId string) error {
+	ids, err := a.apiKeys.RevokeUserApiKeys(ctx, userId)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		a.revocations.hub.CloseTokenSessions(id)
+	}
+	return a.RevokeUserTokens(ctx, userId)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"go-rest-websockets/repository"
+	"log"
+)
+
+// BootstrapAdmin grants the admin role to the account with the given email
+// while no admin exists yet, so a fresh install can hand out roles. Once an
+// admin exists it does nothing, the setting cannot be used to take over an
+// installation later on. The account must exist and have a verified email.
+func BootstrapAdmin(ctx context.Context, repo repository.Repository, email string) error {
+	if email == "" {
+		return nil
+	}
+	exists, err := repo.HasUserWithRole(ctx, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	user, err := repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user.Id == "" {
+		return fmt.Errorf("no account with email %s, sign up and restart", email)
+	}
+	if !user.EmailVerified {
+		return fmt.Errorf("account %s must verify its email before becoming admin", email)
+	}
+	err = repo.AddUserRole(ctx, user.Id, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	log.Println("Granted the admin role to", user.Id)
+	return nil
+}
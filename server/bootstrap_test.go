@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"testing"
+)
+
+// bootstrapRepository holds users by email and the roles granted to them.
+type bootstrapRepository struct {
+	repository.Repository
+	users map[string]*models.User
+	roles map[string][]string
+}
+
+func (r *bootstrapRepository) HasUserWithRole(ctx context.Context, role string) (bool, error) {
+	for _, roles := range r.roles {
+		for _, granted := range roles {
+			if granted == role {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (r *bootstrapRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, ok := r.users[email]
+	if !ok {
+		return &models.User{}, nil
+	}
+	return user, nil
+}
+
+func (r *bootstrapRepository) AddUserRole(ctx context.Context, userId string, role string) error {
+	r.roles[userId] = append(r.roles[userId], role)
+	return nil
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	cases := []struct {
+		name    string
+		email   string
+		admin   bool
+		granted bool
+		fails   bool
+	}{
+		{"without email", "", false, false, false},
+		{"verified account", "verified@doe.com", false, true, false},
+		{"admin already there", "verified@doe.com", true, false, false},
+		{"unknown account", "missing@doe.com", false, false, true},
+		// anyone could sign up with the configured address before its owner
+		{"unverified account", "unverified@doe.com", false, false, true},
+	}
+	for _, c := range cases {
+		repo := &bootstrapRepository{
+			users: map[string]*models.User{
+				"verified@doe.com":   {Id: "verified", EmailVerified: true},
+				"unverified@doe.com": {Id: "unverified"},
+			},
+			roles: map[string][]string{},
+		}
+		if c.admin {
+			repo.roles["admin"] = []string{RoleAdmin}
+		}
+		err := BootstrapAdmin(context.Background(), repo, c.email)
+		if (err != nil) != c.fails {
+			t.Errorf("%s: error is %v, want failure %v", c.name, err, c.fails)
+		}
+		granted := len(repo.roles["verified"]) > 0 || len(repo.roles["unverified"]) > 0
+		if granted != c.granted {
+			t.Errorf("%s: admin granted is %v, want %v", c.name, granted, c.granted)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/segmentio/ksuid"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+	rsaKeyBits     = 2048
+	// createdAtHeader records in the PEM file when the key was generated, file
+	// times change when keys are copied or restored.
+	createdAtHeader = "Created-At"
+	// keyReloadInterval is how often the key directory is read again to pick
+	// up keys rotated by another instance.
+	keyReloadInterval = time.Minute
+	// keyReloadMinWait keeps unknown kids from forcing a reload per request.
+	keyReloadMinWait = 5 * time.Second
+)
+
+type SigningKey struct {
+	Id        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	CreatedAt time.Time
+	RetiredAt time.Time
+}
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySet holds the key used to sign new tokens plus the retired keys that are
+// still accepted for verification until the overlap window has passed. The
+// overlap must be at least as long as the token lifetime.
+//
+// Several instances may share the key directory. Only the rotator generates
+// keys, the others pick them up by reading the directory again.
+type KeySet struct {
+	dir        string
+	algorithm  string
+	interval   time.Duration
+	overlap    time.Duration
+	rotator    bool
+	mutex      *sync.RWMutex
+	keys       []*SigningKey
+	lastReload time.Time
+}
+
+func LoadKeySet(dir string, algorithm string, interval time.Duration, overlap time.Duration, rotator bool) (*KeySet, error) {
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %s", algorithm)
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := &KeySet{
+		dir:       dir,
+		algorithm: algorithm,
+		interval:  interval,
+		overlap:   overlap,
+		rotator:   rotator,
+		mutex:     &sync.RWMutex{},
+	}
+	err = keySet.Reload()
+	if err != nil {
+		return nil, err
+	}
+	if len(keySet.keys) == 0 {
+		if !rotator {
+			return nil, fmt.Errorf("no signing keys in %s, start the key rotator first", dir)
+		}
+		err = keySet.Rotate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keySet, nil
+}
+
+// Reload reads the key directory again, replacing the keys held in memory.
+func (k *KeySet) Reload() error {
+	files, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*SigningKey, 0, len(files))
+	for _, file := range files {
+		key, err := readSigningKey(file)
+		if err != nil {
+			return fmt.Errorf("cannot read signing key %s: %v", file, err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	for i := 0; i < len(keys)-1; i++ {
+		keys[i].RetiredAt = keys[i+1].CreatedAt
+	}
+
+	now := time.Now()
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.lastReload = now
+	// keep serving the known keys if the directory was emptied under us
+	if len(keys) == 0 && len(k.keys) > 0 {
+		return nil
+	}
+	k.keys = keys
+	k.prune(now)
+	return nil
+}
+
+func readSigningKey(file string) (*SigningKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		Id: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+	}
+	key.CreatedAt, err = keyCreatedAt(block, key.Id)
+	if err != nil {
+		return nil, err
+	}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.Private = private
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.Private = private
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return key, nil
+}
+
+// keyCreatedAt reads the creation time from the PEM header. Keys written
+// before the header was added are named after a KSUID, which embeds it.
+func keyCreatedAt(block *pem.Block, id string) (time.Time, error) {
+	if value, ok := block.Headers[createdAtHeader]; ok {
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	parsed, err := ksuid.Parse(id)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("missing %s header", createdAtHeader)
+	}
+	return parsed.Time(), nil
+}
+
+func (k *KeySet) generateKey() (*SigningKey, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{Id: id.String(), CreatedAt: time.Now()}
+	switch k.algorithm {
+	case AlgorithmRS256:
+		private, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.Private = private
+	case AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.Method = jwt.SigningMethodEdDSA
+		key.Private = private
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{createdAtHeader: key.CreatedAt.UTC().Format(time.RFC3339Nano)},
+		Bytes:   der,
+	})
+	// other instances read the directory, so never let them see a partial file
+	file := filepath.Join(k.dir, key.Id+".pem")
+	err = os.WriteFile(file+".tmp", data, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(file+".tmp", file)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *KeySet) Rotate() error {
+	key, err := k.generateKey()
+	if err != nil {
+		return err
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if len(k.keys) > 0 {
+		k.keys[len(k.keys)-1].RetiredAt = key.CreatedAt
+	}
+	k.keys = append(k.keys, key)
+	k.prune(key.CreatedAt)
+	log.Println("Rotated signing key, active key is", key.Id)
+	return nil
+}
+
+func (k *KeySet) isAccepted(key *SigningKey, now time.Time) bool {
+	return key.RetiredAt.IsZero() || now.Before(key.RetiredAt.Add(k.overlap))
+}
+
+func (k *KeySet) prune(now time.Time) {
+	active := make([]*SigningKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		if k.isAccepted(key, now) {
+			active = append(active, key)
+		}
+	}
+	k.keys = active
+}
+
+// RunRotation reads the key directory every keyReloadInterval and, on the
+// rotator, generates a new key once the active one is older than the interval.
+func (k *KeySet) RunRotation(ctx context.Context) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := k.Reload()
+			if err != nil {
+				log.Printf("error reloading signing keys %v", err)
+				continue
+			}
+			if k.rotator && !time.Now().Before(k.SigningKey().CreatedAt.Add(k.interval)) {
+				err = k.Rotate()
+				if err != nil {
+					log.Printf("error rotating signing key %v", err)
+				}
+			}
+		}
+	}
+}
+
+func (k *KeySet) SigningKey() *SigningKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.keys[len(k.keys)-1]
+}
+
+// VerificationKey looks the kid up, reading the key directory again when it
+// is unknown since another instance may have just rotated.
+func (k *KeySet) VerificationKey(id string) (*SigningKey, bool) {
+	key, ok, lastReload := k.findKey(id)
+	if ok || time.Since(lastReload) < keyReloadMinWait {
+		return key, ok
+	}
+	err := k.Reload()
+	if err != nil {
+		log.Printf("error reloading signing keys %v", err)
+		return nil, false
+	}
+	key, ok, _ = k.findKey(id)
+	return key, ok
+}
+
+func (k *KeySet) findKey(id string) (*SigningKey, bool, time.Time) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.Id == id && k.isAccepted(key, now) {
+			return key, true, k.lastReload
+		}
+	}
+	return nil, false, k.lastReload
+}
+
+func (k *KeySet) JWKS() JSONWebKeySet {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	now := time.Now()
+	keySet := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(k.keys))}
+	for _, key := range k.keys {
+		if !k.isAccepted(key, now) {
+			continue
+		}
+		jwk := JSONWebKey{
+			KeyId:     key.Id,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+		}
+		switch public := key.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+	return keySet
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testKeyInterval = 3 * time.Hour
+	testKeyOverlap  = 2 * time.Hour
+)
+
+func loadTestKeySet(t *testing.T, dir string, algorithm string, rotator bool) *KeySet {
+	t.Helper()
+	keys, err := LoadKeySet(dir, algorithm, testKeyInterval, testKeyOverlap, rotator)
+	if err != nil {
+		t.Fatalf("loading key set: %v", err)
+	}
+	return keys
+}
+
+func TestLoadKeySetGeneratesFirstKey(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		dir := t.TempDir()
+		keys := loadTestKeySet(t, dir, algorithm, true)
+		key := keys.SigningKey()
+		if key.Method.Alg() != algorithm {
+			t.Errorf("key signs with %s, want %s", key.Method.Alg(), algorithm)
+		}
+		if _, err := os.Stat(filepath.Join(dir, key.Id+".pem")); err != nil {
+			t.Errorf("key file of %s: %v", algorithm, err)
+		}
+	}
+}
+
+func TestLoadKeySetRejectsUnknownAlgorithm(t *testing.T) {
+	_, err := LoadKeySet(t.TempDir(), "HS256", testKeyInterval, testKeyOverlap, true)
+	if err == nil {
+		t.Fatal("HS256 accepted")
+	}
+}
+
+func TestKeySetKeepsCreationTimeAcrossLoads(t *testing.T) {
+	dir := t.TempDir()
+	key := loadTestKeySet(t, dir, AlgorithmEdDSA, true).SigningKey()
+	// copying or restoring key files changes their times, which must not matter
+	old := time.Now().Add(-48 * time.Hour)
+	err := os.Chtimes(filepath.Join(dir, key.Id+".pem"), old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadTestKeySet(t, dir, AlgorithmEdDSA, true).SigningKey()
+	if loaded.Id != key.Id || !loaded.CreatedAt.Equal(key.CreatedAt) {
+		t.Fatalf("loaded key %s created at %v, want %s created at %v", loaded.Id, loaded.CreatedAt, key.Id, key.CreatedAt)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	keys := loadTestKeySet(t, t.TempDir(), AlgorithmEdDSA, true)
+	first := keys.SigningKey()
+	err := keys.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := keys.SigningKey()
+	if second.Id == first.Id {
+		t.Fatal("rotation kept the signing key")
+	}
+	if first.RetiredAt.IsZero() {
+		t.Fatal("previous key was not retired")
+	}
+	// tokens signed before the rotation still verify during the overlap
+	for _, key := range []*SigningKey{first, second} {
+		if _, ok := keys.VerificationKey(key.Id); !ok {
+			t.Errorf("key %s is not accepted", key.Id)
+		}
+	}
+	if ids := jwksKeyIds(keys); !ids[first.Id] || !ids[second.Id] {
+		t.Errorf("jwks holds %v, want both keys", ids)
+	}
+
+	// once the overlap has passed the retired key is gone
+	first.RetiredAt = time.Now().Add(-testKeyOverlap - time.Minute)
+	if _, ok := keys.VerificationKey(first.Id); ok {
+		t.Error("key retired past the overlap is accepted")
+	}
+	if ids := jwksKeyIds(keys); ids[first.Id] {
+		t.Error("key retired past the overlap is published")
+	}
+}
+
+func TestKeySetRejectsUnknownKey(t *testing.T) {
+	keys := loadTestKeySet(t, t.TempDir(), AlgorithmEdDSA, true)
+	if _, ok := keys.VerificationKey("unknown"); ok {
+		t.Fatal("unknown key accepted")
+	}
+}
+
+func TestKeySetSharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadKeySet(dir, AlgorithmEdDSA, testKeyInterval, testKeyOverlap, false)
+	if err == nil {
+		t.Fatal("instance without rotation started without keys")
+	}
+
+	rotator := loadTestKeySet(t, dir, AlgorithmEdDSA, true)
+	follower := loadTestKeySet(t, dir, AlgorithmEdDSA, false)
+	if follower.SigningKey().Id != rotator.SigningKey().Id {
+		t.Fatal("instances sign with different keys")
+	}
+
+	err = rotator.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := rotator.SigningKey()
+	// an unknown kid makes the follower read the directory again
+	follower.lastReload = time.Time{}
+	if _, ok := follower.VerificationKey(rotated.Id); !ok {
+		t.Fatal("follower does not accept the rotated key")
+	}
+	if follower.SigningKey().Id != rotated.Id {
+		t.Fatal("follower does not sign with the rotated key")
+	}
+}
+
+func TestAuthorizationSignsAndVerifies(t *testing.T) {
+	keys := loadTestKeySet(t, t.TempDir(), AlgorithmRS256, true)
+	auth := NewAuthorization(keys, newTestRevocationStore(), nil, nil)
+
+	challenge, err := auth.SignMFAChallenge("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.ParseAndVerifyMFAChallenge(challenge)
+	if err != nil {
+		t.Fatalf("verifying challenge: %v", err)
+	}
+	if claims.UserId != "user" {
+		t.Errorf("user is %s, want user", claims.UserId)
+	}
+	// the audience keeps a challenge from passing as a session token
+	if _, err := auth.ParseAndVerifyToken(challenge); err == nil {
+		t.Error("challenge accepted as a session token")
+	}
+
+	err = keys.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ParseAndVerifyMFAChallenge(challenge); err != nil {
+		t.Errorf("token signed before the rotation rejected: %v", err)
+	}
+}
+
+func jwksKeyIds(keys *KeySet) map[string]bool {
+	ids := map[string]bool{}
+	for _, key := range keys.JWKS().Keys {
+		ids[key.KeyId] = true
+	}
+	return ids
+}
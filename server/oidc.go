@@ -0,0 +1,396 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OIDCLoginLifetime  = 10 * time.Minute
+	oidcScopes         = "openid email profile"
+	oidcKeyRefreshWait = time.Minute
+)
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+}
+
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSUri               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IdToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type oidcJSONWebKey struct {
+	KeyType string `json:"kty"`
+	KeyId   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// oidcAudience accepts both forms of the aud claim, a single string or a list.
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a oidcAudience) contains(value string) bool {
+	for _, audience := range a {
+		if audience == value {
+			return true
+		}
+	}
+	return false
+}
+
+type oidcClaims struct {
+	jwt.StandardClaims
+	Audience      oidcAudience `json:"aud"`
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified bool         `json:"email_verified"`
+}
+
+// OIDCLogin is a login waiting for the provider callback. It is kept by the
+// browser that started it, see SignOIDCLogin, so the callback can only
+// complete logins started by the same browser.
+type OIDCLogin struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// OIDCProvider signs users in with the authorization code flow and PKCE
+// against a single OpenID Connect issuer.
+type OIDCProvider struct {
+	config      OIDCConfig
+	redirectUrl string
+	client      *http.Client
+	discovery   oidcDiscovery
+	mutex       *sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func NewOIDCProvider(ctx context.Context, config OIDCConfig, redirectUrl string) (*OIDCProvider, error) {
+	p := &OIDCProvider{
+		config:      config,
+		redirectUrl: redirectUrl,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		mutex:       &sync.Mutex{},
+		keys:        map[string]crypto.PublicKey{},
+	}
+	err := p.getJSON(ctx, strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &p.discovery)
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover oidc provider: %v", err)
+	}
+	if p.discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc provider reports issuer %s instead of %s", p.discovery.Issuer, config.Issuer)
+	}
+	if p.discovery.AuthorizationEndpoint == "" || p.discovery.TokenEndpoint == "" || p.discovery.JWKSUri == "" {
+		return nil, fmt.Errorf("oidc provider discovery document is incomplete")
+	}
+	err = p.refreshKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *OIDCProvider) Issuer() string {
+	return p.discovery.Issuer
+}
+
+// StartLogin starts a login and returns it with the provider URL to redirect
+// the user to.
+func (p *OIDCProvider) StartLogin() (*OIDCLogin, string, error) {
+	state, err := randomURLString()
+	if err != nil {
+		return nil, "", err
+	}
+	nonce, err := randomURLString()
+	if err != nil {
+		return nil, "", err
+	}
+	verifier, err := randomURLString()
+	if err != nil {
+		return nil, "", err
+	}
+	login := &OIDCLogin{State: state, Nonce: nonce, Verifier: verifier}
+
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientId)
+	query.Set("redirect_uri", p.redirectUrl)
+	query.Set("scope", oidcScopes)
+	query.Set("state", login.State)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return login, p.discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange completes the login with the code returned by the provider and
+// returns the identity asserted by the verified id token. The caller must
+// check the state returned with the code against login.State.
+func (p *OIDCProvider) Exchange(ctx context.Context, login *OIDCLogin, code string) (*OIDCIdentity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectUrl)
+	form.Set("client_id", p.config.ClientId)
+	form.Set("code_verifier", login.Verifier)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	tokens := oidcTokenResponse{}
+	err = json.NewDecoder(response.Body).Decode(&tokens)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode token response: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+
+	claims, err := p.verifyIdToken(ctx, tokens.IdToken, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCIdentity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+func (p *OIDCProvider) verifyIdToken(ctx context.Context, idToken string, nonce string) (*oidcClaims, error) {
+	claims := &oidcClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %v", err)
+	}
+	if claims.Issuer != p.discovery.Issuer {
+		return nil, fmt.Errorf("id token issued by %s", claims.Issuer)
+	}
+	if !claims.Audience.contains(p.config.ClientId) {
+		return nil, fmt.Errorf("id token not issued for this client")
+	}
+	if claims.ExpiresAt == 0 || claims.Subject == "" {
+		return nil, fmt.Errorf("id token is missing required claims")
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("id token nonce does not match")
+	}
+	return claims, nil
+}
+
+// publicKey looks the key up by id, refetching the provider keys at most once
+// a minute so a rotation at the provider is picked up.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mutex.Lock()
+	key, ok := p.lookupKey(kid)
+	stale := time.Since(p.keysFetched) > oidcKeyRefreshWait
+	p.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+
+	err := p.refreshKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key, ok = p.lookupKey(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+	return key, nil
+}
+
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) refreshKeys(ctx context.Context) error {
+	set := struct {
+		Keys []oidcJSONWebKey `json:"keys"`
+	}{}
+	err := p.getJSON(ctx, p.discovery.JWKSUri, &set)
+	if err != nil {
+		return fmt.Errorf("cannot fetch oidc provider keys: %v", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyId] = key
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.mutex.Unlock()
+	return nil
+}
+
+func (k oidcJSONWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.KeyType)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, location string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", response.Status, location)
+	}
+	return json.NewDecoder(response.Body).Decode(value)
+}
+
+func randomURLString() (string, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
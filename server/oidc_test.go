@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testOIDCClientId = "go-rest-websockets"
+	testOIDCCode     = "code"
+)
+
+// mockOIDCProvider is an issuer serving discovery, keys and a token endpoint
+// that checks the PKCE verifier against the challenge of the login.
+type mockOIDCProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	// claims overrides the id token claims issued by the token endpoint
+	claims func(claims jwt.MapClaims)
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDCProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSUri:               m.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		encode := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []oidcJSONWebKey{{
+			KeyType: "RSA",
+			KeyId:   "mock",
+			Use:     "sig",
+			N:       encode(key.N.Bytes()),
+			E:       encode(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if r.PostFormValue("code") != testOIDCCode || base64.RawURLEncoding.EncodeToString(verifier[:]) != m.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(oidcTokenResponse{Error: "invalid_grant"})
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "subject",
+		"aud":            testOIDCClientId,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          m.nonce,
+		"email":          "john@doe.com",
+		"email_verified": true,
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(oidcTokenResponse{IdToken: idToken})
+}
+
+// login starts a login against the mock provider.
+func (m *mockOIDCProvider) login(t *testing.T, provider *OIDCProvider) *OIDCLogin {
+	t.Helper()
+	login, location, err := provider.StartLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorize, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorize.Query()
+	if query.Get("state") != login.State {
+		t.Fatalf("state is %s, want %s", query.Get("state"), login.State)
+	}
+	m.challenge = query.Get("code_challenge")
+	m.nonce = query.Get("nonce")
+	return login
+}
+
+func newTestOIDCProvider(t *testing.T, m *mockOIDCProvider) *OIDCProvider {
+	t.Helper()
+	config := OIDCConfig{Issuer: m.server.URL, ClientId: testOIDCClientId, ClientSecret: "secret"}
+	provider, err := NewOIDCProvider(context.Background(), config, "http://localhost:5050/login/oidc/callback")
+	if err != nil {
+		t.Fatalf("discovering mock provider: %v", err)
+	}
+	return provider
+}
+
+func TestOIDCExchange(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	provider := newTestOIDCProvider(t, m)
+	login := m.login(t, provider)
+
+	identity, err := provider.Exchange(context.Background(), login, testOIDCCode)
+	if err != nil {
+		t.Fatalf("exchanging code: %v", err)
+	}
+	want := OIDCIdentity{Issuer: m.server.URL, Subject: "subject", Email: "john@doe.com", EmailVerified: true}
+	if *identity != want {
+		t.Errorf("identity is %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidLogins(t *testing.T) {
+	cases := []struct {
+		name   string
+		code   string
+		claims func(claims jwt.MapClaims)
+	}{
+		{"rejected code", "wrong", nil},
+		{"other issuer", testOIDCCode, func(claims jwt.MapClaims) { claims["iss"] = "https://other.example" }},
+		{"other client", testOIDCCode, func(claims jwt.MapClaims) { claims["aud"] = []string{"other"} }},
+		{"replayed nonce", testOIDCCode, func(claims jwt.MapClaims) { claims["nonce"] = "other" }},
+		{"expired", testOIDCCode, func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"without subject", testOIDCCode, func(claims jwt.MapClaims) { delete(claims, "sub") }},
+	}
+	m := newMockOIDCProvider(t)
+	provider := newTestOIDCProvider(t, m)
+	for _, c := range cases {
+		m.claims = c.claims
+		login := m.login(t, provider)
+		if _, err := provider.Exchange(context.Background(), login, c.code); err == nil {
+			t.Errorf("%s: login accepted", c.name)
+		}
+	}
+}
+
+func TestOIDCExchangeRejectsOtherLogin(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	provider := newTestOIDCProvider(t, m)
+	m.login(t, provider)
+	other, _, err := provider.StartLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the code was issued for the PKCE challenge of the first login
+	if _, err := provider.Exchange(context.Background(), other, testOIDCCode); err == nil {
+		t.Fatal("code exchanged for another login")
+	}
+}
+
+func TestOIDCLoginToken(t *testing.T) {
+	keys := loadTestKeySet(t, t.TempDir(), AlgorithmEdDSA, true)
+	auth := NewAuthorization(keys, newTestRevocationStore(), nil, nil)
+	login := &OIDCLogin{State: "state", Nonce: "nonce", Verifier: "verifier"}
+	token, err := auth.SignOIDCLogin(login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := auth.ParseOIDCLogin(token)
+	if err != nil {
+		t.Fatalf("parsing login: %v", err)
+	}
+	if *parsed != *login {
+		t.Errorf("login is %+v, want %+v", *parsed, *login)
+	}
+	if _, err := auth.ParseAndVerifyToken(token); err == nil {
+		t.Error("login accepted as a session token")
+	}
+
+	challenge, err := auth.SignMFAChallenge("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ParseOIDCLogin(challenge); err == nil {
+		t.Error("mfa challenge accepted as a login")
+	}
+	if _, err := auth.ParseOIDCLogin(token + "x"); err == nil {
+		t.Error("tampered login accepted")
+	}
+}
+
+func TestOIDCProviderRejectsIssuerMismatch(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	config := OIDCConfig{Issuer: m.server.URL + "/", ClientId: testOIDCClientId}
+	if _, err := NewOIDCProvider(context.Background(), config, "http://localhost:5050/login/oidc/callback"); err == nil {
+		t.Fatal("provider reporting another issuer accepted")
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+type Permission string
+
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+
+	PermissionPostsDeleteAny    Permission = "posts:delete:any"
+	PermissionCommentsDeleteAny Permission = "comments:delete:any"
+	PermissionRolesManage       Permission = "roles:manage"
+	PermissionUsersImpersonate  Permission = "users:impersonate"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleModerator: {PermissionPostsDeleteAny, PermissionCommentsDeleteAny},
+	RoleAdmin:     {PermissionPostsDeleteAny, PermissionCommentsDeleteAny, PermissionRolesManage, PermissionUsersImpersonate},
+}
+
+func IsKnownRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func (p *Principal) Can(permission Permission) bool {
+	for _, role := range p.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
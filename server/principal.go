@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+type Principal struct {
+	UserId    string
+	Roles     []string
+	TokenId   string
+	SessionId string
+	ExpiresAt time.Time
+	ApiKeyId  string
+	// EmailVerified is the state when the token was issued, so a user has to
+	// log in again after verifying to lift unverified restrictions.
+	EmailVerified bool
+	// Scopes restricts what the principal may do. A nil Scopes means the
+	// principal is not scope restricted, which is the case for user sessions.
+	Scopes []string
+	// ActorId is the admin acting as UserId when the principal comes from an
+	// impersonation token. ReadOnly blocks unsafe requests for such tokens.
+	ActorId  string
+	ReadOnly bool
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// CredentialId identifies the token or API key the principal authenticated
+// with, so connections opened with it can be closed when it is revoked.
+func (p *Principal) CredentialId() string {
+	if p.ApiKeyId != "" {
+		return p.ApiKeyId
+	}
+	return p.TokenId
+}
+
+func (p *Principal) IsImpersonated() bool {
+	return p.ActorId != ""
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, current := range p.Roles {
+		if current == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, current := range p.Scopes {
+		if current == scope {
+			return true
+		}
+	}
+	return false
+}
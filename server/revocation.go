@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"go-rest-websockets/models"
+	"go-rest-websockets/repository"
+	"go-rest-websockets/websockets"
+	"log"
+	"sync"
+	"time"
+)
+
+// revocationReloadInterval bounds how long a revocation made on another
+// instance goes unnoticed.
+const revocationReloadInterval = 10 * time.Second
+
+// RevocationStore keeps revoked tokens in memory so token verification does
+// not hit the database, writing every revocation through to the repository
+// and loading the ones of other instances every revocationReloadInterval.
+type RevocationStore struct {
+	repo   repository.RevocationRepository
+	hub    *websockets.Hub
+	mutex  *sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+func NewRevocationStore(repo repository.RevocationRepository, hub *websockets.Hub) *RevocationStore {
+	return &RevocationStore{
+		repo:   repo,
+		hub:    hub,
+		mutex:  &sync.RWMutex{},
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+// Load merges the revocations of the repository into memory, closing the
+// websocket sessions of the ones not seen before, as other instances may
+// have made them.
+func (s *RevocationStore) Load(ctx context.Context) error {
+	now := time.Now()
+	tokens, err := s.repo.GetRevokedTokens(ctx, now)
+	if err != nil {
+		return err
+	}
+	users, err := s.repo.GetUserTokenRevocations(ctx)
+	if err != nil {
+		return err
+	}
+
+	revokedTokens := make([]string, 0)
+	revokedUsers := make([]string, 0)
+	s.mutex.Lock()
+	for tokenId, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, tokenId)
+		}
+	}
+	for _, token := range tokens {
+		if _, ok := s.tokens[token.TokenId]; !ok {
+			revokedTokens = append(revokedTokens, token.TokenId)
+		}
+		s.tokens[token.TokenId] = token.ExpiresAt
+	}
+	for _, user := range users {
+		revokedBefore, ok := s.users[user.UserId]
+		if ok && !user.RevokedBefore.After(revokedBefore) {
+			continue
+		}
+		revokedUsers = append(revokedUsers, user.UserId)
+		s.users[user.UserId] = user.RevokedBefore
+	}
+	s.mutex.Unlock()
+
+	for _, tokenId := range revokedTokens {
+		s.hub.CloseTokenSessions(tokenId)
+	}
+	for _, userId := range revokedUsers {
+		s.hub.CloseUserSessions(userId)
+	}
+	return nil
+}
+
+// Run loads the revocations every revocationReloadInterval until the context
+// is done.
+func (s *RevocationStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(revocationReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.Load(ctx)
+			if err != nil {
+				log.Printf("error loading token revocations %v", err)
+			}
+		}
+	}
+}
+
+func (s *RevocationStore) RevokeToken(ctx context.Context, tokenId string, userId string, expiresAt time.Time) error {
+	token := models.RevokedToken{
+		TokenId:   tokenId,
+		UserId:    userId,
+		ExpiresAt: expiresAt,
+	}
+	err := s.repo.RevokeToken(ctx, &token)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	now := time.Now()
+	for tokenId, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, tokenId)
+		}
+	}
+	s.tokens[token.TokenId] = token.ExpiresAt
+	s.mutex.Unlock()
+
+	s.hub.CloseTokenSessions(token.TokenId)
+	return nil
+}
+
+func (s *RevocationStore) RevokeUserTokens(ctx context.Context, userId string) error {
+	revocation := models.UserTokenRevocation{
+		UserId:        userId,
+		RevokedBefore: time.Now(),
+	}
+	err := s.repo.RevokeUserTokens(ctx, &revocation)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.users[userId] = revocation.RevokedBefore
+	s.mutex.Unlock()
+
+	s.hub.CloseUserSessions(userId)
+	return nil
+}
+
+func (s *RevocationStore) IsRevoked(claims *models.AppClaims) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if _, ok := s.tokens[claims.Id]; ok {
+		return true
+	}
+	revokedBefore, ok := s.users[claims.UserId]
+	if !ok {
+		return false
+	}
+	if claims.IssuedAtNano != 0 {
+		return !time.Unix(0, claims.IssuedAtNano).After(revokedBefore)
+	}
+	// tokens signed before iatNano was added only carry iat, which has second
+	// precision, so one issued in the same second as the revocation is treated
+	// as revoked as well
+	return claims.IssuedAt <= revokedBefore.Unix()
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt"
+	"go-rest-websockets/models"
+	"go-rest-websockets/websockets"
+	"testing"
+	"time"
+)
+
+// revocationRepository keeps revocations in memory.
+type revocationRepository struct {
+	tokens []models.RevokedToken
+	users  map[string]models.UserTokenRevocation
+}
+
+func (r *revocationRepository) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	r.tokens = append(r.tokens, *token)
+	return nil
+}
+
+func (r *revocationRepository) RevokeUserTokens(ctx context.Context, revocation *models.UserTokenRevocation) error {
+	r.users[revocation.UserId] = *revocation
+	return nil
+}
+
+func (r *revocationRepository) GetRevokedTokens(ctx context.Context, expiringAfter time.Time) ([]models.RevokedToken, error) {
+	tokens := make([]models.RevokedToken, 0)
+	for _, token := range r.tokens {
+		if token.ExpiresAt.After(expiringAfter) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *revocationRepository) GetUserTokenRevocations(ctx context.Context) ([]models.UserTokenRevocation, error) {
+	revocations := make([]models.UserTokenRevocation, 0)
+	for _, revocation := range r.users {
+		revocations = append(revocations, revocation)
+	}
+	return revocations, nil
+}
+
+func newTestRevocationStore() *RevocationStore {
+	return NewRevocationStore(&revocationRepository{users: map[string]models.UserTokenRevocation{}}, websockets.NewHub())
+}
+
+func testClaims(id string, userId string, issuedAt time.Time) *models.AppClaims {
+	return &models.AppClaims{
+		StandardClaims: jwt.StandardClaims{Id: id, IssuedAt: issuedAt.Unix()},
+		UserId:         userId,
+		IssuedAtNano:   issuedAt.UnixNano(),
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	store := newTestRevocationStore()
+	now := time.Now()
+	err := store.RevokeToken(context.Background(), "token", "user", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.IsRevoked(testClaims("token", "user", now)) {
+		t.Error("revoked token accepted")
+	}
+	if store.IsRevoked(testClaims("other", "user", now)) {
+		t.Error("other token of the user rejected")
+	}
+}
+
+func TestRevokeTokenForgetsExpiredTokens(t *testing.T) {
+	store := newTestRevocationStore()
+	ctx := context.Background()
+	_ = store.RevokeToken(ctx, "expired", "user", time.Now().Add(-time.Minute))
+	_ = store.RevokeToken(ctx, "token", "user", time.Now().Add(time.Hour))
+	if _, ok := store.tokens["expired"]; ok {
+		t.Error("expired token is still held")
+	}
+	if _, ok := store.tokens["token"]; !ok {
+		t.Error("live token was forgotten")
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	store := newTestRevocationStore()
+	before := time.Now()
+	err := store.RevokeUserTokens(context.Background(), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Add(time.Nanosecond)
+
+	if !store.IsRevoked(testClaims("old", "user", before)) {
+		t.Error("token issued before the revocation accepted")
+	}
+	// a login right after logging out everywhere, often within the same second
+	if store.IsRevoked(testClaims("new", "user", after)) {
+		t.Error("token issued after the revocation rejected")
+	}
+	if store.IsRevoked(testClaims("other", "other", before)) {
+		t.Error("token of another user rejected")
+	}
+}
+
+func TestRevokeUserTokensWithoutPreciseIssueTime(t *testing.T) {
+	store := newTestRevocationStore()
+	revokedBefore := time.Unix(1652454245, 500000000)
+	store.users["user"] = revokedBefore
+	cases := []struct {
+		issuedAt int64
+		revoked  bool
+	}{
+		{revokedBefore.Unix() - 1, true},
+		// iat alone cannot tell which side of the revocation the token is on
+		{revokedBefore.Unix(), true},
+		{revokedBefore.Unix() + 1, false},
+	}
+	for _, c := range cases {
+		claims := &models.AppClaims{StandardClaims: jwt.StandardClaims{Id: "token", IssuedAt: c.issuedAt}, UserId: "user"}
+		if store.IsRevoked(claims) != c.revoked {
+			t.Errorf("token issued at %d revoked is %v, want %v", c.issuedAt, !c.revoked, c.revoked)
+		}
+	}
+}
+
+func TestRevocationStoreLoad(t *testing.T) {
+	repo := &revocationRepository{users: map[string]models.UserTokenRevocation{}}
+	now := time.Now()
+	repo.tokens = []models.RevokedToken{
+		{TokenId: "token", UserId: "user", ExpiresAt: now.Add(time.Hour)},
+		{TokenId: "expired", UserId: "user", ExpiresAt: now.Add(-time.Hour)},
+	}
+	repo.users["revoked"] = models.UserTokenRevocation{UserId: "revoked", RevokedBefore: now}
+
+	store := NewRevocationStore(repo, websockets.NewHub())
+	err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.IsRevoked(testClaims("token", "user", now)) {
+		t.Error("loaded token revocation ignored")
+	}
+	if _, ok := store.tokens["expired"]; ok {
+		t.Error("expired token was loaded")
+	}
+	if !store.IsRevoked(testClaims("any", "revoked", now.Add(-time.Second))) {
+		t.Error("loaded user revocation ignored")
+	}
+}
+
+func TestRevocationStoreLoadsOtherInstances(t *testing.T) {
+	repo := &revocationRepository{users: map[string]models.UserTokenRevocation{}}
+	store := NewRevocationStore(repo, websockets.NewHub())
+	other := NewRevocationStore(repo, websockets.NewHub())
+	ctx := context.Background()
+	now := time.Now()
+
+	err := other.RevokeToken(ctx, "token", "user", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.RevokeUserTokens(ctx, "revoked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.IsRevoked(testClaims("token", "user", now)) {
+		t.Error("token revoked on another instance accepted")
+	}
+	if !store.IsRevoked(testClaims("any", "revoked", now)) {
+		t.Error("user revoked on another instance accepted")
+	}
+
+	// a later revocation held in memory is kept over the one loaded
+	later := time.Now().Add(time.Minute)
+	store.users["revoked"] = later
+	err = store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.users["revoked"].Equal(later) {
+		t.Errorf("user revoked before %v, want %v", store.users["revoked"], later)
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateSecret returns a random secret to hand to the user once and the
+// hash to store in its place.
+func GenerateSecret(prefix string) (string, string, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", "", err
+	}
+	secret := prefix + base64.RawURLEncoding.EncodeToString(random)
+	return secret, HashSecret(secret), nil
+}
+
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,12 +7,42 @@ import (
 	"go-rest-websockets/websockets"
 	"log"
 	"net/http"
+	"time"
 )
 
 type Config struct {
-	Port        string
-	JWTSecret   string
-	DatabaseUrl string
+	Port           string
+	JWTKeysDir     string
+	JWTAlgorithm   string
+	JWTKeyRotation time.Duration
+	JWTKeyOverlap  time.Duration
+	// JWTKeyRotator makes this instance generate the signing keys. When
+	// several instances share JWTKeysDir exactly one of them should rotate.
+	JWTKeyRotator bool
+	DatabaseUrl   string
+	PublicUrl     string
+	TOTPIssuer    string
+	// AccountDeletion is either AccountDeletionDelete, which removes the user
+	// and their posts, or AccountDeletionAnonymize, which keeps the posts.
+	AccountDeletion string
+	// RequireVerifiedEmail lists the restrictions applied to accounts that
+	// have not verified their email address yet.
+	RequireVerifiedEmail VerifiedEmailRestrictions
+	// OIDC enables login through an external OpenID Connect provider when
+	// an issuer is set.
+	OIDC OIDCConfig
+	// SessionCookies lets browser clients keep the session token in a cookie
+	// instead of handling it themselves.
+	SessionCookies SessionCookieConfig
+}
+
+const (
+	AccountDeletionDelete    = "delete"
+	AccountDeletionAnonymize = "anonymize"
+)
+
+type VerifiedEmailRestrictions struct {
+	ToPost bool
 }
 
 type Server interface {
@@ -31,8 +61,24 @@ func NewServer(ctx context.Context, config *Config, hub *websockets.Hub) (*Broke
 		return nil, fmt.Errorf("port is required")
 	}
 
-	if config.JWTSecret == "" {
-		return nil, fmt.Errorf("jwt secret is required")
+	if config.AccountDeletion != AccountDeletionDelete && config.AccountDeletion != AccountDeletionAnonymize {
+		return nil, fmt.Errorf("account deletion policy must be %s or %s", AccountDeletionDelete, AccountDeletionAnonymize)
+	}
+
+	if config.JWTKeysDir == "" {
+		return nil, fmt.Errorf("jwt keys directory is required")
+	}
+
+	if config.JWTKeyOverlap < TokenLifetime {
+		return nil, fmt.Errorf("jwt key overlap must be at least %v", TokenLifetime)
+	}
+
+	if config.JWTKeyRotation <= config.JWTKeyOverlap {
+		return nil, fmt.Errorf("jwt key rotation must be longer than the key overlap")
+	}
+
+	if config.OIDC.Issuer != "" && config.OIDC.ClientId == "" {
+		return nil, fmt.Errorf("oidc client id is required")
 	}
 
 	if config.DatabaseUrl == "" {
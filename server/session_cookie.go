@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+const (
+	SessionCookieName   = "session"
+	CSRFCookieName      = "csrf_token"
+	CSRFHeaderName      = "X-CSRF-Token"
+	OIDCLoginCookieName = "oidc_login"
+)
+
+type SessionCookieConfig struct {
+	Enabled bool
+	// Insecure drops the Secure attribute so cookies work over plain http
+	// during local development.
+	Insecure bool
+}
+
+// SetSessionCookies stores the session token in an HttpOnly cookie next to a
+// readable CSRF cookie, which the client echoes in the CSRF header on unsafe
+// requests. The CSRF token is returned so it can also be sent in the body.
+func SetSessionCookies(w http.ResponseWriter, config SessionCookieConfig, token string) (string, error) {
+	csrfToken, err := randomURLString()
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(TokenLifetime)
+	http.SetCookie(w, sessionCookie(config, SessionCookieName, token, expires, true))
+	http.SetCookie(w, sessionCookie(config, CSRFCookieName, csrfToken, expires, false))
+	return csrfToken, nil
+}
+
+func ClearSessionCookies(w http.ResponseWriter, config SessionCookieConfig) {
+	http.SetCookie(w, sessionCookie(config, SessionCookieName, "", time.Unix(0, 0), true))
+	http.SetCookie(w, sessionCookie(config, CSRFCookieName, "", time.Unix(0, 0), false))
+}
+
+// SetOIDCLoginCookie keeps the pending login in the browser that started it.
+// Lax lets the cookie come along on the redirect back from the provider.
+func SetOIDCLoginCookie(w http.ResponseWriter, config SessionCookieConfig, token string) {
+	http.SetCookie(w, oidcLoginCookie(config, token, time.Now().Add(OIDCLoginLifetime)))
+}
+
+func ClearOIDCLoginCookie(w http.ResponseWriter, config SessionCookieConfig) {
+	http.SetCookie(w, oidcLoginCookie(config, "", time.Unix(0, 0)))
+}
+
+func oidcLoginCookie(config SessionCookieConfig, token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     OIDCLoginCookieName,
+		Value:    token,
+		Path:     "/login/oidc",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !config.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func sessionCookie(config SessionCookieConfig, name string, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: httpOnly,
+		Secure:   !config.Insecure,
+		// Strict also keeps the cookie off cross-site websocket handshakes,
+		// which the CSRF header cannot protect.
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// ValidCSRFToken reports whether the request echoes its CSRF cookie in the header.
+func ValidCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeaderName)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
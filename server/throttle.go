@@ -0,0 +1,161 @@
+package server
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+	ThrottleMFA     = "mfa"
+	// ThrottleResetEmail and ThrottleResetIP limit password reset emails,
+	// where every request counts as an attempt.
+	ThrottleResetEmail = "reset-email"
+	ThrottleResetIP    = "reset-ip"
+)
+
+type ThrottleConfig struct {
+	// FreeAttempts is how many failures are allowed before backoff kicks in.
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// ForgetAfter drops the failure history of a key that stayed quiet this long.
+	ForgetAfter time.Duration
+}
+
+type throttleEntry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// LoginThrottle tracks failed attempts per key, such as an account or a client
+// address, and blocks the key for an exponentially growing delay. Every kind
+// of key has its own limits, so a shared address can be more lenient than an
+// account.
+type LoginThrottle struct {
+	configs   map[string]ThrottleConfig
+	mutex     *sync.Mutex
+	entries   map[string]*throttleEntry
+	lastSweep time.Time
+}
+
+func NewLoginThrottle(configs map[string]ThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		configs:   configs,
+		mutex:     &sync.Mutex{},
+		entries:   make(map[string]*throttleEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Check returns how long the caller must wait before trying any of the keys
+// again. When no wait is needed the attempt is counted as a failure right
+// away, so concurrent requests cannot all slip through before the first one
+// fails. Call Success or Release once the attempt turns out to be good.
+func (t *LoginThrottle) Check(keys ...string) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		entry := t.entry(key, now)
+		if entry != nil && entry.blockedUntil.After(now) && entry.blockedUntil.Sub(now) > wait {
+			wait = entry.blockedUntil.Sub(now)
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	for _, key := range keys {
+		entry := t.entry(key, now)
+		if entry == nil {
+			entry = &throttleEntry{}
+			t.entries[key] = entry
+		}
+		entry.failures++
+		entry.lastFailure = now
+		entry.blockedUntil = t.blockedUntil(key, entry)
+	}
+	if now.Sub(t.lastSweep) > time.Minute {
+		t.forget(now)
+		t.lastSweep = now
+	}
+	return 0
+}
+
+// Success clears the failure history of the keys.
+func (t *LoginThrottle) Success(keys ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, key := range keys {
+		delete(t.entries, key)
+	}
+}
+
+// Release gives back the attempt reserved by Check while keeping the earlier
+// failures, for keys such as a shared address that a success does not clear.
+func (t *LoginThrottle) Release(keys ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, key := range keys {
+		entry, ok := t.entries[key]
+		if !ok {
+			continue
+		}
+		entry.failures--
+		if entry.failures <= 0 {
+			delete(t.entries, key)
+			continue
+		}
+		entry.blockedUntil = t.blockedUntil(key, entry)
+	}
+}
+
+// blockedUntil doubles the delay for every failure past the free attempts.
+func (t *LoginThrottle) blockedUntil(key string, entry *throttleEntry) time.Time {
+	config := t.config(key)
+	if entry.failures <= config.FreeAttempts {
+		return time.Time{}
+	}
+	exponent := float64(entry.failures - config.FreeAttempts - 1)
+	delay := time.Duration(float64(config.BaseDelay) * math.Pow(2, exponent))
+	if delay > config.MaxDelay || delay <= 0 {
+		delay = config.MaxDelay
+	}
+	return entry.lastFailure.Add(delay)
+}
+
+func (t *LoginThrottle) entry(key string, now time.Time) *throttleEntry {
+	entry, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.Sub(entry.lastFailure) > t.config(key).ForgetAfter && !entry.blockedUntil.After(now) {
+		delete(t.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (t *LoginThrottle) forget(now time.Time) {
+	for key := range t.entries {
+		t.entry(key, now)
+	}
+}
+
+func ThrottleKey(kind string, value string) string {
+	return kind + ":" + strings.ToLower(strings.TrimSpace(value))
+}
+
+func (t *LoginThrottle) config(key string) ThrottleConfig {
+	kind := key
+	if index := strings.Index(key, ":"); index >= 0 {
+		kind = key[:index]
+	}
+	return t.configs[kind]
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestThrottle() *LoginThrottle {
+	return NewLoginThrottle(map[string]ThrottleConfig{
+		ThrottleAccount: {FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second, ForgetAfter: time.Hour},
+		ThrottleIP:      {FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, ForgetAfter: time.Hour},
+	})
+}
+
+func TestThrottleFreeAttempts(t *testing.T) {
+	throttle := newTestThrottle()
+	key := ThrottleKey(ThrottleAccount, "john@doe.com")
+	// the attempt past the free ones is let through, the one after it waits
+	for i := 0; i < 4; i++ {
+		if wait := throttle.Check(key); wait != 0 {
+			t.Fatalf("attempt %d waits %v", i+1, wait)
+		}
+	}
+	wait := throttle.Check(key)
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("wait after the free attempts is %v, want up to a second", wait)
+	}
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	throttle := newTestThrottle()
+	key := ThrottleKey(ThrottleAccount, "john@doe.com")
+	entry := &throttleEntry{lastFailure: time.Unix(1000, 0)}
+	cases := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, c := range cases {
+		entry.failures = c.failures
+		until := throttle.blockedUntil(key, entry)
+		if c.delay == 0 {
+			if !until.IsZero() {
+				t.Errorf("%d failures block until %v, want no block", c.failures, until)
+			}
+			continue
+		}
+		if delay := until.Sub(entry.lastFailure); delay != c.delay {
+			t.Errorf("%d failures block for %v, want %v", c.failures, delay, c.delay)
+		}
+	}
+}
+
+func TestThrottleKeysAreIndependent(t *testing.T) {
+	throttle := newTestThrottle()
+	john := ThrottleKey(ThrottleAccount, "john@doe.com")
+	jane := ThrottleKey(ThrottleAccount, "jane@doe.com")
+	for i := 0; i < 5; i++ {
+		throttle.Check(john)
+	}
+	if wait := throttle.Check(jane); wait != 0 {
+		t.Fatalf("other account waits %v", wait)
+	}
+}
+
+func TestThrottleKeyNormalization(t *testing.T) {
+	if ThrottleKey(ThrottleAccount, " John@Doe.com ") != ThrottleKey(ThrottleAccount, "john@doe.com") {
+		t.Fatal("keys differ by case or spacing")
+	}
+}
+
+func TestThrottleSuccessResets(t *testing.T) {
+	throttle := newTestThrottle()
+	key := ThrottleKey(ThrottleAccount, "john@doe.com")
+	for i := 0; i < 5; i++ {
+		throttle.Check(key)
+	}
+	throttle.Success(key)
+	for i := 0; i < 4; i++ {
+		if wait := throttle.Check(key); wait != 0 {
+			t.Fatalf("attempt %d after success waits %v", i+1, wait)
+		}
+	}
+}
+
+func TestThrottleReleaseKeepsEarlierFailures(t *testing.T) {
+	throttle := newTestThrottle()
+	key := ThrottleKey(ThrottleIP, "127.0.0.1")
+	for i := 0; i < 3; i++ {
+		throttle.Check(key)
+	}
+	throttle.Check(key)
+	throttle.Release(key)
+	if failures := throttle.entries[key].failures; failures != 3 {
+		t.Fatalf("failures after release are %d, want 3", failures)
+	}
+
+	for i := 0; i < 3; i++ {
+		throttle.Check(key)
+	}
+	if throttle.entries[key].blockedUntil.IsZero() {
+		t.Fatal("key past the free attempts is not blocked")
+	}
+	throttle.Release(key)
+	if !throttle.entries[key].blockedUntil.IsZero() {
+		t.Fatal("release back to the free attempts keeps the block")
+	}
+}
+
+func TestThrottleReleaseLastAttemptForgetsKey(t *testing.T) {
+	throttle := newTestThrottle()
+	key := ThrottleKey(ThrottleIP, "127.0.0.1")
+	throttle.Check(key)
+	throttle.Release(key)
+	if _, ok := throttle.entries[key]; ok {
+		t.Fatal("key without failures is still tracked")
+	}
+}
+
+func TestThrottleForgetsQuietKeys(t *testing.T) {
+	throttle := newTestThrottle()
+	key := ThrottleKey(ThrottleAccount, "john@doe.com")
+	for i := 0; i < 5; i++ {
+		throttle.Check(key)
+	}
+	entry := throttle.entries[key]
+	entry.lastFailure = time.Now().Add(-2 * time.Hour)
+	entry.blockedUntil = entry.lastFailure.Add(time.Second)
+	if wait := throttle.Check(key); wait != 0 {
+		t.Fatalf("quiet key waits %v", wait)
+	}
+	if failures := throttle.entries[key].failures; failures != 1 {
+		t.Fatalf("failures of a forgotten key are %d, want 1", failures)
+	}
+}
+
+func TestThrottleConcurrentAttempts(t *testing.T) {
+	throttle := newTestThrottle()
+	key := ThrottleKey(ThrottleAccount, "john@doe.com")
+	var group sync.WaitGroup
+	var mutex sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if throttle.Check(key) == 0 {
+				mutex.Lock()
+				allowed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	group.Wait()
+	if allowed != 4 {
+		t.Fatalf("%d concurrent attempts let through, want 4", allowed)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA1 seed of the RFC 6238 test vectors.
+var rfc6238Key = []byte("12345678901234567890")
+
+// rfc6238Vectors lists the SHA1 vectors of RFC 6238 appendix B, cut to the
+// last six digits since codes here have six.
+var rfc6238Vectors = []struct {
+	time int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTotpCode(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		code := totpCode(rfc6238Key, uint64(vector.time/totpPeriod))
+		if code != vector.code {
+			t.Errorf("code at %d is %s, want %s", vector.time, code, vector.code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	for _, vector := range rfc6238Vectors {
+		now := time.Unix(vector.time, 0)
+		counter, ok := VerifyTOTP(secret, vector.code, now)
+		if !ok {
+			t.Errorf("code %s rejected at %d", vector.code, vector.time)
+			continue
+		}
+		if counter != vector.time/totpPeriod {
+			t.Errorf("counter of %s is %d, want %d", vector.code, counter, vector.time/totpPeriod)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	issued := time.Unix(1111111109, 0)
+	cases := []struct {
+		now  time.Time
+		want bool
+	}{
+		{issued.Add(-totpPeriod * time.Second), true},
+		{issued.Add(totpPeriod * time.Second), true},
+		{issued.Add(-2 * totpPeriod * time.Second), false},
+		{issued.Add(2 * totpPeriod * time.Second), false},
+	}
+	for _, c := range cases {
+		counter, ok := VerifyTOTP(secret, "081804", c.now)
+		if ok != c.want {
+			t.Errorf("code accepted at %v is %v, want %v", c.now.Unix(), ok, c.want)
+		}
+		if ok && counter != issued.Unix()/totpPeriod {
+			t.Errorf("counter is %d, want the step the code was issued in", counter)
+		}
+	}
+}
+
+func TestVerifyTOTPRejectsMalformedInput(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := VerifyTOTP(secret, code, now); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := VerifyTOTP("not base32!", "287082", now); ok {
+		t.Error("code accepted with an invalid secret")
+	}
+}
@@ -1,15 +1,38 @@
 package websockets
 
 import (
+	"encoding/json"
 	"github.com/gorilla/websocket"
 	"log"
+	"time"
 )
 
+const (
+	maxInboundMessageSize = 1024
+	maxClientTopics       = 50
+	maxTopicLength        = 64
+	// outboundBufferSize is how many messages may wait for a slow connection
+	// before the hub gives up on it.
+	outboundBufferSize = 64
+	// writeWait bounds a single write so a stuck socket releases its writer.
+	writeWait = 10 * time.Second
+)
+
+// ClientCommand is what clients send over the socket to follow topics, e.g.
+// {"type":"subscribe","topic":"post:<id>"}.
+type ClientCommand struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+}
+
 type Client struct {
 	hub      *Hub
 	id       string
+	userId   string
+	tokenId  string
 	socket   *websocket.Conn
 	outbound chan []byte
+	topics   map[string]bool
 }
 
 func NewClient(hub *Hub, socket *websocket.Conn) *Client {
@@ -17,7 +40,8 @@ func NewClient(hub *Hub, socket *websocket.Conn) *Client {
 		hub:      hub,
 		socket:   socket,
 		id:       socket.RemoteAddr().String(),
-		outbound: make(chan []byte),
+		outbound: make(chan []byte, outboundBufferSize),
+		topics:   make(map[string]bool),
 	}
 }
 
@@ -25,11 +49,16 @@ func (c *Client) Write() {
 	for {
 		select {
 		case message, ok := <-c.outbound:
+			_ = c.socket.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				err := c.socket.WriteMessage(websocket.CloseMessage, []byte{})
 				if err != nil {
 					log.Println("Error sending close connection message")
 				}
+				err = c.socket.Close()
+				if err != nil {
+					log.Println("Error closing connection", c.id)
+				}
 				return
 			}
 			err := c.socket.WriteMessage(websocket.BinaryMessage, message)
@@ -39,3 +68,29 @@ func (c *Client) Write() {
 		}
 	}
 }
+
+// Read handles the commands sent by the client until the connection drops,
+// then unregisters it.
+func (c *Client) Read() {
+	defer func() {
+		c.hub.unregister <- c
+	}()
+	c.socket.SetReadLimit(maxInboundMessageSize)
+	for {
+		_, data, err := c.socket.ReadMessage()
+		if err != nil {
+			return
+		}
+		command := ClientCommand{}
+		err = json.Unmarshal(data, &command)
+		if err != nil || command.Topic == "" || len(command.Topic) > maxTopicLength {
+			continue
+		}
+		switch command.Type {
+		case "subscribe":
+			c.hub.Subscribe(c, command.Topic)
+		case "unsubscribe":
+			c.hub.Unsubscribe(c, command.Topic)
+		}
+	}
+}
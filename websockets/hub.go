@@ -8,10 +8,27 @@ import (
 	"sync"
 )
 
+// BearerProtocol lets browsers, which cannot set headers on the handshake,
+// authenticate a connection by offering the protocols "bearer" and the token.
+// Unlike a query parameter the token stays out of proxy and access logs.
+const BearerProtocol = "bearer"
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	Subprotocols: []string{BearerProtocol},
+}
+
+// BearerToken returns the token offered with BearerProtocol on the handshake.
+func BearerToken(r *http.Request) (string, bool) {
+	protocols := websocket.Subprotocols(r)
+	for index, protocol := range protocols {
+		if protocol == BearerProtocol && index+1 < len(protocols) {
+			return protocols[index+1], true
+		}
+	}
+	return "", false
 }
 
 type Hub struct {
@@ -31,6 +48,10 @@ func NewHub() *Hub {
 }
 
 func (hub *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	hub.HandleAuthenticatedWebSocket(w, r, "", "")
+}
+
+func (hub *Hub) HandleAuthenticatedWebSocket(w http.ResponseWriter, r *http.Request, userId string, tokenId string) {
 	socket, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
@@ -39,9 +60,12 @@ func (hub *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := NewClient(hub, socket)
+	client.userId = userId
+	client.tokenId = tokenId
 	hub.register <- client
 
 	go client.Write()
+	go client.Read()
 }
 
 func (hub *Hub) Run() {
@@ -64,10 +88,6 @@ func (hub *Hub) onConnect(client *Client) {
 
 func (hub *Hub) onDisconnect(client *Client) {
 	log.Println("Client disconnected", client.id)
-	err := client.socket.Close()
-	if err != nil {
-		log.Println("Error closing connection", client.id)
-	}
 	hub.mutex.Lock()
 	var indexToRemove = -1
 	for index, currentClient := range hub.clients {
@@ -77,15 +97,131 @@ func (hub *Hub) onDisconnect(client *Client) {
 	}
 	if indexToRemove != -1 {
 		hub.clients = append(hub.clients[:indexToRemove], hub.clients[indexToRemove+1:]...)
+		// Write sends the close frame and releases the socket once outbound is closed
+		close(client.outbound)
 	}
 	hub.mutex.Unlock()
 }
 
-func (hub *Hub) Broadcast(message interface{}, ignore *Client) {
+// deliver queues the message on every matching connection without waiting on
+// any of them. Connections too slow to drain their queue are disconnected.
+func (hub *Hub) deliver(message interface{}, match func(client *Client) bool) {
 	data, _ := json.Marshal(message)
+	hub.mutex.Lock()
+	var stalled []*Client
+	for _, client := range hub.clients {
+		if !match(client) {
+			continue
+		}
+		select {
+		case client.outbound <- data:
+		default:
+			stalled = append(stalled, client)
+		}
+	}
+	hub.mutex.Unlock()
+
+	for _, client := range stalled {
+		log.Println("Client too slow, disconnecting", client.id)
+		hub.unregister <- client
+	}
+}
+
+func (hub *Hub) Broadcast(message interface{}, ignore *Client) {
+	hub.deliver(message, func(client *Client) bool {
+		return client != ignore
+	})
+}
+
+// BroadcastExcept sends the message to every connection except those of the
+// excluded users.
+func (hub *Hub) BroadcastExcept(message interface{}, excludedUserIds []string) {
+	excluded := make(map[string]bool, len(excludedUserIds))
+	for _, userId := range excludedUserIds {
+		excluded[userId] = true
+	}
+	hub.deliver(message, func(client *Client) bool {
+		return client.userId == "" || !excluded[client.userId]
+	})
+}
+
+func (hub *Hub) SendToUser(userId string, message interface{}) {
+	hub.deliver(message, func(client *Client) bool {
+		return client.userId != "" && client.userId == userId
+	})
+}
+
+// SendToUsers delivers one message to every connection of the given users.
+func (hub *Hub) SendToUsers(userIds []string, message interface{}) {
+	if len(userIds) == 0 {
+		return
+	}
+	recipients := make(map[string]bool, len(userIds))
+	for _, userId := range userIds {
+		recipients[userId] = true
+	}
+	hub.deliver(message, func(client *Client) bool {
+		return client.userId != "" && recipients[client.userId]
+	})
+}
+
+// PostTopic is the topic clients subscribe to for live updates on a post.
+func PostTopic(postId string) string {
+	return "post:" + postId
+}
+
+func (hub *Hub) Subscribe(client *Client, topic string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if len(client.topics) < maxClientTopics {
+		client.topics[topic] = true
+	}
+}
+
+func (hub *Hub) Unsubscribe(client *Client, topic string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	delete(client.topics, topic)
+}
+
+// Publish sends the message to the connections subscribed to the topic,
+// except those of the excluded users.
+func (hub *Hub) Publish(topic string, message interface{}, excludedUserIds []string) {
+	excluded := make(map[string]bool, len(excludedUserIds))
+	for _, userId := range excludedUserIds {
+		excluded[userId] = true
+	}
+	hub.deliver(message, func(client *Client) bool {
+		return client.topics[topic] && (client.userId == "" || !excluded[client.userId])
+	})
+}
+
+func (hub *Hub) CloseTokenSessions(tokenId string) {
+	if tokenId == "" {
+		return
+	}
+	hub.closeWhere(func(client *Client) bool {
+		return client.tokenId == tokenId
+	})
+}
+
+func (hub *Hub) CloseUserSessions(userId string) {
+	hub.closeWhere(func(client *Client) bool {
+		return client.userId == userId
+	})
+}
+
+func (hub *Hub) closeWhere(match func(client *Client) bool) {
+	hub.mutex.Lock()
+	var toClose []*Client
 	for _, client := range hub.clients {
-		if client != ignore {
-			client.outbound <- data
+		if client.userId != "" && match(client) {
+			toClose = append(toClose, client)
 		}
 	}
+	hub.mutex.Unlock()
+
+	for _, client := range toClose {
+		hub.unregister <- client
+	}
 }